@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Config scopes a profile can be activated in, passed to git config as is
+const (
+	scopeLocal    = "--local"
+	scopeWorktree = "--worktree"
+	scopeGlobal   = "--global"
+)
+
+// scopeFromFlags maps the --global and --worktree flags to a config scope.
+func scopeFromFlags(global, worktree bool) (string, error) {
+	switch {
+	case global && worktree:
+		return "", fmt.Errorf("cannot combine --global and --worktree")
+	case global:
+		return scopeGlobal, nil
+	case worktree:
+		return scopeWorktree, nil
+	}
+	return scopeLocal, nil
+}
+
+// scopeDescription names a config scope in user facing messages.
+func scopeDescription(scope string) string {
+	switch scope {
+	case scopeGlobal:
+		return "global git config"
+	case scopeWorktree:
+		return "current worktree"
+	default:
+		return "current repository"
+	}
+}
+
+// checkScope verifies that the config file of scope can be written from the
+// current directory.
+func checkScope(scope string) error {
+	if scope == scopeGlobal {
+		return nil
+	}
+
+	if _, err := runGitCommand("rev-parse", "--git-dir"); err != nil {
+		return fmt.Errorf("not a git repository (or any of the parent directories)")
+	}
+
+	if scope == scopeWorktree {
+		enabled, err := getConfigBool("extensions.worktreeConfig")
+		if err != nil {
+			return fmt.Errorf("failed to read extensions.worktreeConfig: %w", err)
+		}
+		if !enabled {
+			return fmt.Errorf("worktree config is not enabled, run 'git config extensions.worktreeConfig true' first")
+		}
+	}
+
+	return nil
+}
+
+// checkGlobalOverride refuses to replace a global identity that was not
+// written by gitprofile with a different one.
+func checkGlobalOverride(profile Profile, state *repoState) error {
+	identity := []configEntry{
+		{Key: "user.name", Value: profile.Name},
+		{Key: "user.email", Value: profile.Email},
+	}
+
+	for _, entry := range identity {
+		if state.IsManaged(entry.Key) {
+			continue
+		}
+
+		current, exists, err := getConfigValue(scopeGlobal, entry.Key)
+		if err != nil {
+			return fmt.Errorf("failed to read global %s: %w", entry.Key, err)
+		}
+		if exists && current != entry.Value {
+			return fmt.Errorf("global %s is already set to '%s', use --force to override it", entry.Key, current)
+		}
+	}
+
+	return nil
+}
+
+// changeAction is what activating a profile does to a single config key.
+type changeAction string
+
+const (
+	actionSet     changeAction = "set"
+	actionChange  changeAction = "change"
+	actionUnset   changeAction = "unset"
+	actionRestore changeAction = "restore"
+)
+
+// configChange is a single planned modification of the repository config.
+type configChange struct {
+	Action changeAction `json:"action"`
+	Key    string       `json:"key"`
+	Old    string       `json:"old,omitempty"`
+	New    string       `json:"new,omitempty"`
+}
+
+// activationPlan is the full reconciliation of a repository's config with a
+// profile: keys the profile needs are set or changed, and keys a previous
+// profile owned but the new one does not get back the value they had before
+// gitprofile, or are unset if they had none.
+type activationPlan struct {
+	ProfileName string
+	Profile     Profile
+	Dir         string
+	Scope       string
+	Changes     []configChange
+	Unchanged   []configEntry
+}
+
+// planActivation compares the config of the state's scope with the config
+// the profile needs. It does not modify anything.
+func planActivation(profileName string, profile Profile, state *repoState) (*activationPlan, error) {
+	plan := &activationPlan{ProfileName: profileName, Profile: profile, Dir: state.dir, Scope: state.scope}
+
+	desired := make(map[string]bool)
+	for _, entry := range profile.gitConfigEntries() {
+		desired[strings.ToLower(entry.Key)] = true
+
+		current, exists, err := getConfigValueIn(state.dir, state.scope, entry.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Key, err)
+		}
+
+		switch {
+		case !exists:
+			plan.Changes = append(plan.Changes, configChange{Action: actionSet, Key: entry.Key, New: entry.Value})
+		case current != entry.Value:
+			plan.Changes = append(plan.Changes, configChange{Action: actionChange, Key: entry.Key, Old: current, New: entry.Value})
+		default:
+			plan.Unchanged = append(plan.Unchanged, entry)
+		}
+	}
+
+	// Keys owned by the previously active profile that the new one lacks
+	for _, key := range state.Managed {
+		if desired[strings.ToLower(key)] {
+			continue
+		}
+
+		current, exists, err := getConfigValueIn(state.dir, state.scope, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+
+		previous, hasPrevious := state.PreviousValue(key)
+		switch {
+		case hasPrevious && (!exists || current != previous):
+			plan.Changes = append(plan.Changes, configChange{Action: actionRestore, Key: key, Old: current, New: previous})
+		case !hasPrevious && exists:
+			plan.Changes = append(plan.Changes, configChange{Action: actionUnset, Key: key, Old: current})
+		}
+	}
+
+	return plan, nil
+}
+
+// apply executes the plan against the config of its scope and records the
+// active profile in the state of that scope. Keys the profile does not set
+// are no longer managed afterwards, their previous value is written back
+// before the snapshot of it is dropped.
+func (p *activationPlan) apply(state *repoState) error {
+	desired := make(map[string]bool)
+	for _, entry := range p.Profile.gitConfigEntries() {
+		desired[strings.ToLower(entry.Key)] = true
+	}
+
+	for _, change := range p.Changes {
+		if change.Action == actionUnset {
+			if _, err := runGitCommandIn(p.Dir, "config", p.Scope, "--unset-all", change.Key); err != nil {
+				return fmt.Errorf("failed to unset %s: %w", change.Key, err)
+			}
+			continue
+		}
+		if change.Action == actionRestore {
+			if _, err := runGitCommandIn(p.Dir, "config", p.Scope, change.Key, change.New); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", change.Key, err)
+			}
+			continue
+		}
+
+		if err := state.manageKey(change.Key, change.Old, change.Action == actionChange); err != nil {
+			return fmt.Errorf("failed to record %s: %w", change.Key, err)
+		}
+		if _, err := runGitCommandIn(p.Dir, "config", p.Scope, change.Key, change.New); err != nil {
+			return fmt.Errorf("failed to set %s: %w", change.Key, err)
+		}
+	}
+
+	// Keys that already had the right value still belong to the profile now
+	for _, entry := range p.Unchanged {
+		if err := state.manageKey(entry.Key, entry.Value, true); err != nil {
+			return fmt.Errorf("failed to record %s: %w", entry.Key, err)
+		}
+	}
+
+	for _, key := range append([]string(nil), state.Managed...) {
+		if desired[strings.ToLower(key)] {
+			continue
+		}
+		if err := state.releaseKey(key); err != nil {
+			return fmt.Errorf("failed to release %s: %w", key, err)
+		}
+	}
+
+	if err := state.setProfile(p.ProfileName); err != nil {
+		return fmt.Errorf("failed to record active profile: %w", err)
+	}
+
+	return nil
+}
+
+// printSummary writes one line per planned change.
+func (p *activationPlan) printSummary(w io.Writer) {
+	for _, change := range p.Changes {
+		switch change.Action {
+		case actionSet:
+			fmt.Fprintf(w, "  set     %s = %s\n", change.Key, change.New)
+		case actionChange:
+			fmt.Fprintf(w, "  changed %s: %s -> %s\n", change.Key, change.Old, change.New)
+		case actionUnset:
+			fmt.Fprintf(w, "  removed %s (was %s)\n", change.Key, change.Old)
+		case actionRestore:
+			fmt.Fprintf(w, "  restored %s = %s\n", change.Key, change.New)
+		}
+	}
+}
+
+// prepareActivation loads the state of scope of the repository in dir and
+// plans the activation of a profile in it. An empty dir is the current
+// directory.
+func prepareActivation(dir, profileName string, profile Profile, scope string) (*activationPlan, *repoState, error) {
+	if err := profile.checkSigning(); err != nil {
+		return nil, nil, fmt.Errorf("invalid signing configuration of profile '%s': %w", profileName, err)
+	}
+	if err := profile.checkSSH(); err != nil {
+		return nil, nil, fmt.Errorf("invalid ssh configuration of profile '%s': %w", profileName, err)
+	}
+
+	state, err := loadRepoState(dir, scope)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read gitprofile state: %w", err)
+	}
+
+	plan, err := planActivation(profileName, profile, state)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return plan, state, nil
+}
+
+// applyProfile reconciles the config of scope of the repository in dir with a
+// profile.
+func applyProfile(dir, profileName string, profile Profile, scope string) (*activationPlan, error) {
+	plan, state, err := prepareActivation(dir, profileName, profile, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := plan.apply(state); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
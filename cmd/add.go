@@ -7,40 +7,94 @@ import (
 )
 
 func NewAddCmd() *cobra.Command {
-	var name, email, gpgKey, sshKey string
-	var signCommits bool
+	var name, email, gpgKey, sshKey, extends string
+	var signingFormat, allowedSigners, x509Program string
+	var sshProgram string
+	var sshPort int
+	var signCommits, sshIdentitiesOnly bool
+	var remotes, settings, sshOptions []string
 
 	cmd := &cobra.Command{
 		Use:   "add [profile-name]",
 		Short: "Add a new git profile",
 		Long: `Add a new git profile with name, email, and optional GPG key and SSH key settings.
-The profile will be saved in ~/.gitprofiles.json`,
+The profile is saved in the profiles file, see 'gitprofile config path'.`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Validate required fields
-			if name == "" {
+			if err := validateProfileName(args[0]); err != nil {
+				return err
+			}
+
+			// Validate required fields, a profile extending another may inherit them
+			if name == "" && extends == "" {
 				return fmt.Errorf("name is required")
 			}
-			if email == "" {
+			if email == "" && extends == "" {
 				return fmt.Errorf("email is required")
 			}
+			if err := validateSigningFormat(signingFormat); err != nil {
+				return err
+			}
 
-			profileName := args[0]
-			profiles, err := LoadProfiles()
-			if err != nil {
-				return fmt.Errorf("failed to load profiles: %w", err)
+			var gitConfig map[string]string
+			for _, setting := range settings {
+				key, value, err := parseConfigAssignment(setting)
+				if err != nil {
+					return err
+				}
+				if gitConfig == nil {
+					gitConfig = make(map[string]string)
+				}
+				gitConfig[key] = value
 			}
 
-			profiles[profileName] = Profile{
+			// Booleans not given on the command line are left unset, so a
+			// profile extending another inherits them
+			var signCommitsValue, sshIdentitiesOnlyValue *bool
+			if cmd.Flags().Changed("sign") {
+				signCommitsValue = boolPtr(signCommits)
+			}
+			if cmd.Flags().Changed("ssh-identities-only") {
+				sshIdentitiesOnlyValue = boolPtr(sshIdentitiesOnly)
+			}
+
+			profileName := args[0]
+			profile := Profile{
+				Extends:     extends,
 				Name:        name,
 				Email:       email,
 				GPGKey:      gpgKey,
-				SignCommits: signCommits,
+				SignCommits: signCommitsValue,
 				SSHKey:      sshKey,
+				Remotes:     remotes,
+				GitConfig:   gitConfig,
+
+				SigningFormat:      signingFormat,
+				AllowedSignersFile: allowedSigners,
+				X509Program:        x509Program,
+
+				SSHProgram:        sshProgram,
+				SSHPort:           sshPort,
+				SSHIdentitiesOnly: sshIdentitiesOnlyValue,
+				SSHOptions:        sshOptions,
+			}
+			if err := profile.checkSSH(); err != nil {
+				return err
 			}
 
-			if err := SaveProfiles(profiles); err != nil {
-				return fmt.Errorf("failed to save profiles: %w", err)
+			err := UpdateProfiles(func(profiles ProfileMap) error {
+				profiles[profileName] = profile
+				resolved, _, err := resolveProfile(profiles, profileName)
+				if err != nil {
+					return err
+				}
+				if resolved.Name == "" || resolved.Email == "" {
+					return fmt.Errorf("name and email are required, neither set nor inherited")
+				}
+				return nil
+			})
+			if err != nil {
+				return err
 			}
 
 			fmt.Printf("Profile '%s' added successfully\n", profileName)
@@ -54,11 +108,25 @@ The profile will be saved in ~/.gitprofiles.json`,
 		},
 	}
 
+	cmd.Flags().StringVar(&extends, "extends", "", "Profile to inherit unset fields from")
+	cmd.RegisterFlagCompletionFunc("extends", ValidProfileArgs)
 	cmd.Flags().StringVar(&name, "name", "", "Git user name")
 	cmd.Flags().StringVar(&email, "email", "", "Git email")
-	cmd.Flags().StringVar(&gpgKey, "gpg-key", "", "GPG key ID")
+	cmd.Flags().StringVar(&gpgKey, "gpg-key", "", "GPG key ID (or signing key path with --signing-format ssh)")
 	cmd.Flags().StringVar(&sshKey, "ssh-key", "", "SSH key file path (e.g., ~/.ssh/id_rsa)")
-	cmd.Flags().BoolVar(&signCommits, "sign", false, "Enable commit signing")
+	cmd.Flags().StringVar(&sshProgram, "ssh-program", "", "SSH binary used for git operations (default ssh)")
+	cmd.Flags().IntVar(&sshPort, "ssh-port", 0, "SSH port passed to ssh with -p")
+	cmd.Flags().BoolVar(&sshIdentitiesOnly, "ssh-identities-only", false, "Only offer the profile's SSH key, not the ones in ssh-agent")
+	cmd.Flags().StringArrayVar(&sshOptions, "ssh-option", nil, "SSH option passed with -o (e.g., StrictHostKeyChecking=accept-new), can be repeated")
+	cmd.Flags().BoolVar(&signCommits, "sign", false, "Enable commit and tag signing")
+	cmd.Flags().StringVar(&signingFormat, "signing-format", "", "Signing format (openpgp, ssh or x509)")
+	cmd.Flags().StringVar(&allowedSigners, "allowed-signers", "", "Allowed signers file for verifying ssh signatures")
+	cmd.Flags().StringVar(&x509Program, "x509-program", "", "Program used for x509 signing (default gpgsm)")
+	cmd.RegisterFlagCompletionFunc("signing-format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{SigningFormatOpenPGP, SigningFormatSSH, SigningFormatX509}, cobra.ShellCompDirectiveNoFileComp
+	})
+	cmd.Flags().StringArrayVar(&remotes, "remote", nil, "Remote URL pattern that selects this profile (e.g., github.com:acme/*), can be repeated")
+	cmd.Flags().StringArrayVar(&settings, "set", nil, "Additional git config key=value applied with the profile (e.g., pull.rebase=true), can be repeated")
 
 	return cmd
 }
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// findRepositories returns every directory below root that is the top of a
+// git working tree. Linked worktrees and submodules have a .git file instead
+// of a directory and are included as well.
+func findRepositories(root string) ([]string, error) {
+	var repos []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// Unreadable directories are skipped
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" {
+			return fs.SkipDir
+		}
+		if _, err := os.Lstat(filepath.Join(path, ".git")); err == nil {
+			repos = append(repos, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(repos)
+	return repos, nil
+}
+
+// gitCommonDir returns the absolute path of the directory holding the shared
+// config of the repository in dir. Worktrees of one repository share it.
+func gitCommonDir(dir string) (string, error) {
+	output, err := runGitCommandIn(dir, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return "", err
+	}
+
+	commonDir := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(dir, commonDir)
+	}
+	return filepath.Clean(commonDir), nil
+}
+
+// applyResult is the outcome of applying a profile to one repository.
+type applyResult struct {
+	Dir        string
+	Plan       *activationPlan
+	SharedWith string
+	Err        error
+}
+
+// applyToRepositories activates a profile in every repository using at most
+// jobs concurrent workers. Repositories sharing their config with an earlier
+// one (linked worktrees) are not written twice.
+func applyToRepositories(repos []string, profileName string, profile Profile, jobs int, dryRun bool) []applyResult {
+	results := make([]applyResult, len(repos))
+
+	// Several worktrees writing one config file would fight over its lock
+	var targets []int
+	owners := make(map[string]string)
+	for i, repo := range repos {
+		results[i].Dir = repo
+		commonDir, err := gitCommonDir(repo)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if owner, ok := owners[commonDir]; ok {
+			results[i].SharedWith = owner
+			continue
+		}
+		owners[commonDir] = repo
+		targets = append(targets, i)
+	}
+
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs && w < len(targets); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				plan, state, err := prepareActivation(repos[i], profileName, profile, scopeLocal)
+				if err == nil && !dryRun {
+					err = plan.apply(state)
+				}
+				results[i].Plan, results[i].Err = plan, err
+			}
+		}()
+	}
+
+	for _, i := range targets {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	return results
+}
+
+func NewApplyCmd() *cobra.Command {
+	var recursive, dryRun bool
+	var jobs int
+
+	cmd := &cobra.Command{
+		Use:   "apply [profile-name] [directory]",
+		Short: "Use a git profile in many repositories at once",
+		Long: `Activate a profile in the repository at a directory, or with --recursive in
+every repository below it, including worktrees and submodules. Repositories
+are processed concurrently by a bounded number of workers and a result is
+printed for each of them.`,
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profileName := args[0]
+			profiles, err := LoadProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to load profiles: %w", err)
+			}
+
+			profile, exists := profiles[profileName]
+			if !exists {
+				return fmt.Errorf("profile '%s' not found", profileName)
+			}
+
+			root, err := expandPath(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid directory: %w", err)
+			}
+
+			var repos []string
+			if recursive {
+				repos, err = findRepositories(root)
+				if err != nil {
+					return fmt.Errorf("failed to scan %s: %w", root, err)
+				}
+			} else {
+				if _, err := runGitCommandIn(root, "rev-parse", "--git-dir"); err != nil {
+					return fmt.Errorf("%s is not a git repository, use --recursive to search below it", root)
+				}
+				repos = []string{root}
+			}
+
+			w := cmd.OutOrStdout()
+
+			if len(repos) == 0 {
+				fmt.Fprintf(w, "No repositories found below %s\n", root)
+				return nil
+			}
+
+			results := applyToRepositories(repos, profileName, profile, jobs, dryRun)
+
+			relative := func(dir string) string {
+				if rel, err := filepath.Rel(root, dir); err == nil {
+					return rel
+				}
+				return dir
+			}
+
+			failed := 0
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "REPOSITORY\tRESULT")
+			for _, result := range results {
+
+				var outcome string
+				switch {
+				case result.Err != nil:
+					failed++
+					outcome = fmt.Sprintf("failed: %v", result.Err)
+				case result.SharedWith != "":
+					outcome = fmt.Sprintf("shares config with %s", relative(result.SharedWith))
+				case len(result.Plan.Changes) == 0:
+					outcome = "unchanged"
+				case dryRun:
+					outcome = fmt.Sprintf("would change %d key(s)", len(result.Plan.Changes))
+				default:
+					outcome = fmt.Sprintf("applied, %d key(s) changed", len(result.Plan.Changes))
+				}
+				fmt.Fprintf(tw, "%s\t%s\n", relative(result.Dir), outcome)
+			}
+			tw.Flush()
+
+			if failed > 0 {
+				return fmt.Errorf("failed to apply profile '%s' to %d of %d repositories", profileName, failed, len(results))
+			}
+
+			if dryRun {
+				fmt.Fprintf(w, "Dry run, no repository was changed\n")
+				return nil
+			}
+			fmt.Fprintf(w, "Profile '%s' applied to %d repositories\n", profileName, len(results))
+			return nil
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return ValidProfileArgs(cmd, args, toComplete)
+			}
+			if len(args) == 1 {
+				return nil, cobra.ShellCompDirectiveFilterDirs
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Apply to every repository below the directory")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the result without changing any repository")
+	cmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "Number of repositories processed concurrently")
+
+	return cmd
+}
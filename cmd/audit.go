@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// auditFinding is a commit field that does not match the expected profile.
+type auditFinding struct {
+	Commit   string `json:"commit"`
+	Field    string `json:"field"`
+	Found    string `json:"found"`
+	Expected string `json:"expected"`
+}
+
+// commitInfo holds the identity related fields of a commit.
+type commitInfo struct {
+	Hash           string
+	AuthorEmail    string
+	CommitterEmail string
+	Signature      string
+}
+
+// logCommits returns the commits of a revision range, newest first. The
+// signature status is only read when withSignatures is set, as verifying
+// signatures is slow and needs the signing tools of every author.
+func logCommits(revisionRange string, withSignatures bool) ([]commitInfo, error) {
+	// Fields are separated by 0x1f, commits by 0x1e
+	format, fieldCount := "%H%x1f%ae%x1f%ce", 3
+	if withSignatures {
+		format, fieldCount = format+"%x1f%G?", 4
+	}
+	output, err := runGitCommand("log", "--format="+format+"%x1e", revisionRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []commitInfo
+	for _, record := range strings.Split(string(output), "\x1e") {
+		record = strings.TrimSpace(record)
+		if record == "" {
+			continue
+		}
+		fields := strings.Split(record, "\x1f")
+		if len(fields) != fieldCount {
+			return nil, fmt.Errorf("unexpected git log output: %q", record)
+		}
+		commit := commitInfo{
+			Hash:           fields[0],
+			AuthorEmail:    fields[1],
+			CommitterEmail: fields[2],
+		}
+		if withSignatures {
+			commit.Signature = fields[3]
+		}
+		commits = append(commits, commit)
+	}
+
+	return commits, nil
+}
+
+// auditRange returns the revision range to audit: the commits after since,
+// else the commits not on the upstream of the current branch, else the whole
+// history.
+func auditRange(since string) string {
+	if since != "" {
+		return since + "..HEAD"
+	}
+	if _, err := runGitCommand("rev-parse", "--verify", "--quiet", "@{upstream}"); err == nil {
+		return "@{upstream}..HEAD"
+	}
+	return "HEAD"
+}
+
+// auditCommits compares each commit with the profile that should have been
+// used for it.
+func auditCommits(commits []commitInfo, profile Profile) []auditFinding {
+	var findings []auditFinding
+	for _, commit := range commits {
+		if commit.AuthorEmail != profile.Email {
+			findings = append(findings, auditFinding{Commit: commit.Hash, Field: "author", Found: commit.AuthorEmail, Expected: profile.Email})
+		}
+		if commit.CommitterEmail != profile.Email {
+			findings = append(findings, auditFinding{Commit: commit.Hash, Field: "committer", Found: commit.CommitterEmail, Expected: profile.Email})
+		}
+		// %G? prints N for commits without any signature
+		if profile.signsCommits() && commit.Signature == "N" {
+			findings = append(findings, auditFinding{Commit: commit.Hash, Field: "signature", Found: "unsigned", Expected: "signed"})
+		}
+	}
+	return findings
+}
+
+// expectedProfileName determines which profile should be active in the
+// current repository: the one recorded by use in any scope, else the one
+// bound to the directory, else the one whose remote rules match origin. The
+// current identity is never used, it is what the audit checks.
+func expectedProfileName(profiles ProfileMap) (string, error) {
+	if recorded, _, err := recordedProfile(""); err != nil {
+		return "", err
+	} else if recorded != "" {
+		return recorded, nil
+	}
+
+	if bound, err := boundProfile(""); err != nil {
+		return "", err
+	} else if bound != "" {
+		return bound, nil
+	}
+
+	if match, err := findRepoRemoteMatch(profiles, "origin"); err == nil {
+		return match.ProfileName, nil
+	}
+
+	return "", fmt.Errorf("cannot determine the expected profile of this repository, use --profile")
+}
+
+func NewAuditCmd() *cobra.Command {
+	var since, profileName, output string
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Find commits made with the wrong identity",
+		Long: `Walk the history of the current repository and report commits whose author or
+committer email does not belong to the profile that should be active here, and
+unsigned commits when the profile signs commits. Without --since the commits
+not on the upstream of the current branch are checked, or the whole history
+when it has no upstream.
+The expected profile is the one activated with 'use', the one bound to the
+directory with 'bind' or the one whose remote rules match origin, unless
+--profile is given. The current identity is never used to pick it. Exits with
+a non-zero status when problems are found.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid output format '%s' (must be table or json)", output)
+			}
+
+			if _, err := runGitCommand("rev-parse", "--git-dir"); err != nil {
+				return fmt.Errorf("not a git repository (or any of the parent directories)")
+			}
+
+			profiles, err := LoadProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to load profiles: %w", err)
+			}
+
+			if profileName == "" {
+				profileName, err = expectedProfileName(profiles)
+				if err != nil {
+					return err
+				}
+			}
+
+			profile, exists := profiles[profileName]
+			if !exists {
+				return fmt.Errorf("profile '%s' not found", profileName)
+			}
+
+			w := cmd.OutOrStdout()
+
+			var commits []commitInfo
+			if _, err := runGitCommand("rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+				commits, err = logCommits(auditRange(since), profile.signsCommits())
+				if err != nil {
+					return fmt.Errorf("failed to read history: %w", err)
+				}
+			}
+
+			findings := auditCommits(commits, profile)
+
+			if output == "json" {
+				if findings == nil {
+					findings = []auditFinding{}
+				}
+				encoder := json.NewEncoder(w)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(findings); err != nil {
+					return err
+				}
+			} else if len(findings) == 0 {
+				fmt.Fprintf(w, "Checked %d commit(s) against profile '%s', no problems found\n", len(commits), profileName)
+			} else {
+				tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "COMMIT\tFIELD\tFOUND\tEXPECTED")
+				for _, finding := range findings {
+					fmt.Fprintf(tw, "%.12s\t%s\t%s\t%s\n", finding.Commit, finding.Field, finding.Found, finding.Expected)
+				}
+				tw.Flush()
+			}
+
+			if len(findings) > 0 {
+				return fmt.Errorf("found %d problem(s) in %d commit(s) checked against profile '%s'", len(findings), len(commits), profileName)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", "", "Only check commits after this ref (default: the upstream of the current branch)")
+	cmd.Flags().StringVar(&profileName, "profile", "", "Profile the commits are expected to use")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format (table or json)")
+	cmd.RegisterFlagCompletionFunc("profile", ValidProfileArgs)
+	cmd.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"table", "json"}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return cmd
+}
@@ -0,0 +1,418 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const includeDirName = ".gitprofile"
+
+// Binding is an includeIf block in the global git config that points at the
+// include file of a profile.
+type Binding struct {
+	Condition   string
+	Profile     string
+	IncludePath string
+}
+
+// expandPath expands a leading ~ to the home directory and makes the path
+// absolute.
+func expandPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(homeDir, path[1:])
+	}
+	return filepath.Abs(path)
+}
+
+// getIncludeDir returns the directory holding the generated per-profile
+// include files. It lives next to the profiles file.
+func getIncludeDir() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), includeDirName), nil
+}
+
+func getIncludePath(profileName string) (string, error) {
+	if profileName == "" || strings.ContainsAny(profileName, `/\`) {
+		return "", fmt.Errorf("profile name '%s' cannot be used as a file name", profileName)
+	}
+
+	dir, err := getIncludeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, profileName+".gitconfig"), nil
+}
+
+// gitdirCondition returns the includeIf condition matching every repository
+// below dir.
+func gitdirCondition(dir string) (string, error) {
+	absDir, err := expandPath(dir)
+	if err != nil {
+		return "", err
+	}
+
+	keyword := "gitdir"
+	if runtime.GOOS == "windows" {
+		keyword = "gitdir/i"
+	}
+	return fmt.Sprintf("%s:%s/", keyword, strings.TrimSuffix(filepath.ToSlash(absDir), "/")), nil
+}
+
+// ownIncludeRegex matches include paths that were written by gitprofile, so
+// includeIf entries added by the user are never replaced or removed.
+func ownIncludeRegex() (string, error) {
+	dir, err := getIncludeDir()
+	if err != nil {
+		return "", err
+	}
+	return "^" + regexp.QuoteMeta(filepath.ToSlash(dir)+"/"), nil
+}
+
+// writeIncludeFile (re)generates the include file of a profile.
+func writeIncludeFile(profileName string, profile Profile) (string, error) {
+	if err := profile.checkSigning(); err != nil {
+		return "", fmt.Errorf("invalid signing configuration: %w", err)
+	}
+	if err := profile.checkSSH(); err != nil {
+		return "", fmt.Errorf("invalid ssh configuration: %w", err)
+	}
+
+	path, err := getIncludePath(profileName)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	for _, entry := range profile.gitConfigEntries() {
+		if _, err := runGitCommand("config", "--file", path, entry.Key, entry.Value); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", entry.Key, err)
+		}
+	}
+
+	return path, nil
+}
+
+// addBinding points the includeIf block for condition at the profile's
+// include file, replacing any earlier gitprofile binding for it.
+func addBinding(condition, includePath string) error {
+	regex, err := ownIncludeRegex()
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("includeIf.%s.path", condition)
+	_, err = runGitCommand("config", "--global", "--replace-all", key, filepath.ToSlash(includePath), regex)
+	return err
+}
+
+// removeBinding removes the gitprofile entry of the includeIf block for
+// condition. It reports false if there was nothing to remove.
+func removeBinding(condition string) (bool, error) {
+	regex, err := ownIncludeRegex()
+	if err != nil {
+		return false, err
+	}
+
+	key := fmt.Sprintf("includeIf.%s.path", condition)
+	if _, err := runGitCommand("config", "--global", "--unset-all", key, regex); err != nil {
+		if gitExitCode(err) == 5 {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// Drop the now empty section unless the user keeps own includes in it.
+	// Recent git versions already remove empty sections on unset, so a
+	// failing --remove-section only means there is nothing left to clean up.
+	if _, err := runGitCommand("config", "--global", "--get-all", key); err != nil {
+		if gitExitCode(err) != 1 {
+			return true, err
+		}
+		runGitCommand("config", "--global", "--remove-section", "includeIf."+condition)
+	}
+
+	return true, nil
+}
+
+// ListBindings returns all includeIf blocks in the global git config that
+// were written by gitprofile.
+func ListBindings() ([]Binding, error) {
+	dir, err := getIncludeDir()
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.ToSlash(dir) + "/"
+
+	entries, err := getConfigRegexp("--global", `^includeif\..*\.path$`)
+	if err != nil {
+		return nil, err
+	}
+
+	var bindings []Binding
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Value, prefix) {
+			continue
+		}
+
+		condition := strings.TrimSuffix(strings.TrimPrefix(entry.Key, "includeif."), ".path")
+		bindings = append(bindings, Binding{
+			Condition:   condition,
+			Profile:     strings.TrimSuffix(filepath.Base(entry.Value), ".gitconfig"),
+			IncludePath: entry.Value,
+		})
+	}
+
+	sort.Slice(bindings, func(i, j int) bool {
+		return bindings[i].Condition < bindings[j].Condition
+	})
+
+	return bindings, nil
+}
+
+func NewBindCmd() *cobra.Command {
+	var remotes bool
+
+	cmd := &cobra.Command{
+		Use:   "bind [profile-name] [directory]",
+		Short: "Activate a profile for every repository below a directory",
+		Long: `Bind a profile to a directory using git's conditional includes.
+The profile settings are written to an include file and an
+[includeIf "gitdir:<directory>/"] block is added to the global git config,
+so every repository below the directory uses the profile automatically.
+With --remotes an [includeIf "hasconfig:remote.*.url:<url>"] block is added
+for each remote rule of the profile instead (requires git 2.36 or newer).
+Running bind again refreshes the include file and moves the binding.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !remotes && len(args) < 2 {
+				return fmt.Errorf("requires a directory or --remotes")
+			}
+
+			profileName := args[0]
+			profiles, err := LoadProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to load profiles: %w", err)
+			}
+
+			profile, exists := profiles[profileName]
+			if !exists {
+				return fmt.Errorf("profile '%s' not found", profileName)
+			}
+
+			var conditions []string
+			if len(args) == 2 {
+				condition, err := gitdirCondition(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid directory: %w", err)
+				}
+				conditions = append(conditions, condition)
+			}
+
+			if remotes {
+				if len(profile.Remotes) == 0 {
+					return fmt.Errorf("profile '%s' has no remote rules", profileName)
+				}
+
+				supported, err := gitVersionAtLeast(2, 36)
+				if err != nil {
+					return fmt.Errorf("failed to determine git version: %w", err)
+				}
+				if !supported {
+					return fmt.Errorf("hasconfig:remote.*.url: conditions require git 2.36 or newer")
+				}
+
+				for _, rule := range profile.Remotes {
+					for _, glob := range remoteURLGlobs(rule) {
+						conditions = append(conditions, "hasconfig:remote.*.url:"+glob)
+					}
+				}
+			}
+
+			includePath, err := writeIncludeFile(profileName, profile)
+			if err != nil {
+				return fmt.Errorf("failed to write include file: %w", err)
+			}
+
+			for _, condition := range conditions {
+				if err := addBinding(condition, includePath); err != nil {
+					return fmt.Errorf("failed to update global git config: %w", err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Profile '%s' bound to %s\n", profileName, condition)
+			}
+
+			return nil
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return ValidProfileArgs(cmd, args, toComplete)
+			}
+			if len(args) == 1 {
+				return nil, cobra.ShellCompDirectiveFilterDirs
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+
+	cmd.Flags().BoolVar(&remotes, "remotes", false, "Bind the profile to its remote rules via hasconfig:remote.*.url:")
+
+	return cmd
+}
+
+func NewUnbindCmd() *cobra.Command {
+	var profileName string
+
+	cmd := &cobra.Command{
+		Use:   "unbind [directory]",
+		Short: "Remove the profile binding of a directory",
+		Long: `Remove the includeIf block that bind added for a directory, or with
+--profile every binding of a profile.
+Include entries that were not written by gitprofile are left untouched.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (len(args) == 0) == (profileName == "") {
+				return fmt.Errorf("requires either a directory or --profile")
+			}
+
+			var conditions []string
+			if len(args) == 1 {
+				condition, err := gitdirCondition(args[0])
+				if err != nil {
+					return fmt.Errorf("invalid directory: %w", err)
+				}
+				conditions = append(conditions, condition)
+			} else {
+				bindings, err := ListBindings()
+				if err != nil {
+					return fmt.Errorf("failed to read global git config: %w", err)
+				}
+				for _, binding := range bindings {
+					if binding.Profile == profileName {
+						conditions = append(conditions, binding.Condition)
+					}
+				}
+				if len(conditions) == 0 {
+					return fmt.Errorf("no bindings found for profile '%s'", profileName)
+				}
+			}
+
+			for _, condition := range conditions {
+				removed, err := removeBinding(condition)
+				if err != nil {
+					return fmt.Errorf("failed to update global git config: %w", err)
+				}
+				if !removed {
+					return fmt.Errorf("no binding found for %s", condition)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Removed binding for %s\n", condition)
+			}
+
+			if err := pruneIncludeFiles(); err != nil {
+				return fmt.Errorf("failed to clean up include files: %w", err)
+			}
+
+			return nil
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return nil, cobra.ShellCompDirectiveFilterDirs
+		},
+	}
+
+	cmd.Flags().StringVar(&profileName, "profile", "", "Remove all bindings of this profile")
+	cmd.RegisterFlagCompletionFunc("profile", ValidProfileArgs)
+
+	return cmd
+}
+
+func NewBindingsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bindings",
+		Short: "List all directory bindings",
+		Long:  `Display every includeIf block gitprofile has added to the global git config`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bindings, err := ListBindings()
+			if err != nil {
+				return fmt.Errorf("failed to read global git config: %w", err)
+			}
+
+			w := cmd.OutOrStdout()
+
+			if len(bindings) == 0 {
+				fmt.Fprintln(w, "No bindings found")
+				return nil
+			}
+
+			for _, binding := range bindings {
+				fmt.Fprintf(w, "%s -> %s\n", binding.Condition, binding.Profile)
+			}
+
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// pruneIncludeFiles deletes include files that no binding refers to anymore.
+func pruneIncludeFiles() error {
+	bindings, err := ListBindings()
+	if err != nil {
+		return err
+	}
+
+	used := make(map[string]bool)
+	for _, binding := range bindings {
+		used[binding.Profile] = true
+	}
+
+	dir, err := getIncludeDir()
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".gitconfig") {
+			continue
+		}
+		if used[strings.TrimSuffix(name, ".gitconfig")] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
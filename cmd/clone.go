@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// profileForURL picks the profile for a URL that is about to be cloned. Remote
+// rules are evaluated first, then the host of the URL is compared with the
+// email domain of each profile, so git.acme.com matches jane@acme.com.
+func profileForURL(profiles ProfileMap, remote string) (string, string, error) {
+	if match := FindRemoteMatch(profiles, remote); match != nil {
+		return match.ProfileName, fmt.Sprintf("remote rule '%s'", match.Rule), nil
+	}
+
+	host, _, _ := strings.Cut(normalizeRemote(remote), ":")
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		_, domain, found := strings.Cut(profiles[name].Email, "@")
+		domain = strings.ToLower(domain)
+		if !found || domain == "" {
+			continue
+		}
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return name, fmt.Sprintf("email domain '%s'", domain), nil
+		}
+	}
+
+	return "", "", fmt.Errorf("no profile rule or email domain matches %s", remote)
+}
+
+// cloneDirectory returns the directory git clone creates for a URL when none
+// is given.
+func cloneDirectory(remote string) (string, error) {
+	_, repoPath, _ := strings.Cut(normalizeRemote(remote), ":")
+	name := path.Base(repoPath)
+	if repoPath == "" || name == "." || name == "/" {
+		return "", fmt.Errorf("cannot derive a directory name from %s, pass one explicitly", remote)
+	}
+	return name, nil
+}
+
+// profileSSHCommand returns the core.sshCommand the profile configures, if
+// any.
+func profileSSHCommand(profile Profile) string {
+	for _, entry := range profile.gitConfigEntries() {
+		if strings.EqualFold(entry.Key, "core.sshCommand") {
+			return entry.Value
+		}
+	}
+	return ""
+}
+
+func NewCloneCmd() *cobra.Command {
+	var fromURL bool
+
+	cmd := &cobra.Command{
+		Use:   "clone [profile-name] [url] [directory]",
+		Short: "Clone a repository and use a git profile in it",
+		Long: `Clone a repository with the SSH key of a profile, so private repositories
+authenticate on the first fetch, and activate the profile in the new clone.
+With --profile-from-url the profile is omitted and picked by the remote rules
+of the profiles or by matching the host of the URL with their email domain.`,
+		Args:         cobra.RangeArgs(1, 3),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profiles, err := LoadProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to load profiles: %w", err)
+			}
+
+			w := cmd.OutOrStdout()
+
+			var profileName string
+			if fromURL {
+				if len(args) > 2 {
+					return fmt.Errorf("expected a url and an optional directory with --profile-from-url")
+				}
+				var reason string
+				profileName, reason, err = profileForURL(profiles, args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "Using profile '%s' (matched by %s)\n", profileName, reason)
+			} else {
+				if len(args) < 2 {
+					return fmt.Errorf("expected a profile and a url, or use --profile-from-url")
+				}
+				profileName, args = args[0], args[1:]
+			}
+
+			profile, exists := profiles[profileName]
+			if !exists {
+				return fmt.Errorf("profile '%s' not found", profileName)
+			}
+			if err := profile.checkSigning(); err != nil {
+				return fmt.Errorf("invalid signing configuration of profile '%s': %w", profileName, err)
+			}
+			if err := profile.checkSSH(); err != nil {
+				return fmt.Errorf("invalid ssh configuration of profile '%s': %w", profileName, err)
+			}
+
+			remote := args[0]
+			dir := ""
+			if len(args) == 2 {
+				dir = args[1]
+			} else if dir, err = cloneDirectory(remote); err != nil {
+				return err
+			}
+
+			// -c only affects the clone, applying the profile writes the key afterwards
+			var cloneArgs []string
+			if sshCommand := profileSSHCommand(profile); sshCommand != "" {
+				cloneArgs = append(cloneArgs, "-c", "core.sshCommand="+sshCommand)
+			}
+			cloneArgs = append(cloneArgs, "clone", remote, dir)
+
+			fmt.Fprintf(w, "Cloning %s into %s\n", remote, dir)
+			if _, err := runGitCommand(cloneArgs...); err != nil {
+				return fmt.Errorf("failed to clone %s: %w", remote, err)
+			}
+
+			absDir, err := filepath.Abs(dir)
+			if err != nil {
+				return err
+			}
+			plan, err := applyProfile(absDir, profileName, profile, scopeLocal)
+			if err != nil {
+				return fmt.Errorf("cloned %s but failed to apply profile '%s': %w", remote, profileName, err)
+			}
+
+			fmt.Fprintf(w, "Successfully activated profile '%s' in %s\n", profileName, dir)
+			plan.printSummary(w)
+			return nil
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 && !cmd.Flags().Changed("profile-from-url") {
+				return ValidProfileArgs(cmd, args, toComplete)
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+
+	cmd.Flags().BoolVar(&fromURL, "profile-from-url", false, "Pick the profile by remote rules or email domain instead of naming it")
+
+	return cmd
+}
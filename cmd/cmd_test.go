@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -20,6 +24,15 @@ func setupTestEnv(t *testing.T) (string, func()) {
 	testConfigPath := filepath.Join(tmpDir, ".gitprofiles.json")
 	SetTestConfigPath(testConfigPath)
 
+	// Keep git away from the user's global config
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(tmpDir, ".gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	// Keep the machine's profile registry out of the tests
+	previousRegistry := systemRegistryPath
+	systemRegistryPath = filepath.Join(tmpDir, "system-profiles.json")
+	t.Cleanup(func() { systemRegistryPath = previousRegistry })
+
 	// Return cleanup function
 	cleanup := func() {
 		os.RemoveAll(tmpDir)
@@ -29,6 +42,21 @@ func setupTestEnv(t *testing.T) (string, func()) {
 	return tmpDir, cleanup
 }
 
+// saveWhileReading runs save before the first read of r, like another
+// invocation saving profiles while a command waits for input.
+type saveWhileReading struct {
+	r    io.Reader
+	save func()
+}
+
+func (s *saveWhileReading) Read(p []byte) (int, error) {
+	if s.save != nil {
+		s.save()
+		s.save = nil
+	}
+	return s.r.Read(p)
+}
+
 func getGitConfig(args ...string) (string, error) {
 	output, err := runGitCommand(append([]string{"config", "--local"}, args...)...)
 	if err != nil {
@@ -93,6 +121,15 @@ func TestAddCommand(t *testing.T) {
 			},
 			expectError: false,
 		},
+		{
+			name: "invalid profile name",
+			args: []string{"my profile"},
+			flags: map[string]string{
+				"name":  "Test User",
+				"email": "test@example.com",
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -142,7 +179,7 @@ func TestListCommand(t *testing.T) {
 			Name:        "User 2",
 			Email:       "user2@example.com",
 			GPGKey:      "ABC123",
-			SignCommits: true,
+			SignCommits: boolPtr(true),
 		},
 	}
 
@@ -185,7 +222,7 @@ func TestUseCommand(t *testing.T) {
 			Name:        "Test User",
 			Email:       "test@example.com",
 			GPGKey:      "ABC123",
-			SignCommits: true,
+			SignCommits: boolPtr(true),
 			SSHKey:      "~/.ssh/id_rsa",
 		},
 	}
@@ -217,7 +254,9 @@ func TestUseCommand(t *testing.T) {
 
 	sshCommand, err := getGitConfig("core.sshCommand")
 	require.NoError(t, err)
-	assert.Contains(t, sshCommand, "~/.ssh/id_rsa")
+	keyPath, err := expandPath("~/.ssh/id_rsa")
+	require.NoError(t, err)
+	assert.Equal(t, "ssh -i "+shellQuote(keyPath), sshCommand)
 }
 
 func TestStatusCommand(t *testing.T) {
@@ -322,3 +361,2118 @@ func TestDeleteCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestBindCommand(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	t.Chdir(tmpDir)
+
+	profiles := ProfileMap{
+		"work": {
+			Name:  "Work User",
+			Email: "work@example.com",
+		},
+	}
+
+	err := SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	workDir := filepath.Join(tmpDir, "work")
+	condition, err := gitdirCondition(workDir)
+	require.NoError(t, err)
+
+	// A user-written include for the same directory must survive
+	_, err = runGitCommand("config", "--global", "--add", "includeIf."+condition+".path", "/custom/include")
+	require.NoError(t, err)
+
+	// Binding twice must not duplicate the entry
+	for i := 0; i < 2; i++ {
+		cmd := NewBindCmd()
+		cmd.SetOut(&bytes.Buffer{})
+		err = cmd.RunE(cmd, []string{"work", workDir})
+		require.NoError(t, err)
+	}
+
+	output, err := runGitCommand("config", "--global", "--get-all", "includeIf."+condition+".path")
+	require.NoError(t, err)
+	values := strings.Split(strings.TrimSpace(string(output)), "\n")
+	assert.Len(t, values, 2)
+	assert.Contains(t, values, "/custom/include")
+
+	includePath, err := getIncludePath("work")
+	require.NoError(t, err)
+	output, err = runGitCommand("config", "--file", includePath, "user.email")
+	require.NoError(t, err)
+	assert.Equal(t, "work@example.com", strings.TrimSpace(string(output)))
+
+	// Test bindings command
+	listCmd := NewBindingsCmd()
+	buffer := &bytes.Buffer{}
+	listCmd.SetOut(buffer)
+	err = listCmd.RunE(listCmd, []string{})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), condition+" -> work")
+	assert.NotContains(t, buffer.String(), "/custom/include")
+
+	// Test unbind command
+	unbindCmd := NewUnbindCmd()
+	unbindCmd.SetOut(&bytes.Buffer{})
+	err = unbindCmd.RunE(unbindCmd, []string{workDir})
+	require.NoError(t, err)
+
+	output, err = runGitCommand("config", "--global", "--get-all", "includeIf."+condition+".path")
+	require.NoError(t, err)
+	assert.Equal(t, "/custom/include", strings.TrimSpace(string(output)))
+
+	_, err = os.Stat(includePath)
+	assert.True(t, os.IsNotExist(err))
+
+	err = unbindCmd.RunE(unbindCmd, []string{workDir})
+	assert.Error(t, err)
+}
+
+func TestMatchRemoteRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		remote  string
+		matches bool
+	}{
+		{"github.com:acme/*", "git@github.com:acme/api.git", true},
+		{"github.com:acme/*", "https://github.com/acme/api.git", true},
+		{"github.com:acme/*", "ssh://git@github.com/acme/api", true},
+		{"github.com/acme/*", "git@github.com:acme/api.git", true},
+		{"github.com:acme/*", "git@github.com:other/api.git", false},
+		{"github.com:acme/*", "git@gitlab.com:acme/api.git", false},
+		{"gitlab.acme.com", "https://gitlab.acme.com/team/api.git", true},
+		{"*.acme.com", "git@gitlab.acme.com:team/api.git", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule+" "+tt.remote, func(t *testing.T) {
+			assert.Equal(t, tt.matches, matchRemoteRule(tt.rule, tt.remote))
+		})
+	}
+}
+
+func TestUseAutoCommand(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err := os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+	_, err = runGitCommand("remote", "add", "origin", "git@github.com:acme/api.git")
+	require.NoError(t, err)
+
+	profiles := ProfileMap{
+		"personal": {
+			Name:    "Personal User",
+			Email:   "me@example.com",
+			Remotes: []string{"github.com:me/*"},
+		},
+		"work": {
+			Name:    "Work User",
+			Email:   "work@acme.com",
+			Remotes: []string{"github.com:acme/*"},
+		},
+	}
+
+	err = SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	autoCmd := NewAutoCmd()
+	buffer := &bytes.Buffer{}
+	autoCmd.SetOut(buffer)
+	err = autoCmd.RunE(autoCmd, []string{})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "Profile: work")
+	assert.Contains(t, buffer.String(), "github.com:acme/*")
+
+	cmd := NewUseCmd()
+	cmd.Flags().Set("auto", "true")
+	err = cmd.RunE(cmd, []string{})
+	require.NoError(t, err)
+
+	email, err := getGitConfig("user.email")
+	require.NoError(t, err)
+	assert.Equal(t, "work@acme.com", email)
+
+	err = cmd.RunE(cmd, []string{"personal"})
+	assert.Error(t, err)
+}
+
+func TestUnuseCommand(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err := os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+
+	profiles := ProfileMap{
+		"testprofile": {
+			Name:   "Test User",
+			Email:  "test@example.com",
+			SSHKey: "~/.ssh/id_rsa",
+		},
+	}
+
+	err = SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	for _, restore := range []bool{false, true} {
+		// Values set by hand before gitprofile was used
+		_, err = runGitCommand("config", "--local", "user.name", "Original User")
+		require.NoError(t, err)
+
+		useCmd := NewUseCmd()
+		err = useCmd.RunE(useCmd, []string{"testprofile"})
+		require.NoError(t, err)
+
+		// Using a profile twice must not overwrite the snapshot
+		err = useCmd.RunE(useCmd, []string{"testprofile"})
+		require.NoError(t, err)
+
+		cmd := NewUnuseCmd()
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.Flags().Set("restore", strconv.FormatBool(restore))
+		err = cmd.RunE(cmd, []string{})
+		require.NoError(t, err)
+
+		name, err := getGitConfig("user.name")
+		if restore {
+			require.NoError(t, err)
+			assert.Equal(t, "Original User", name)
+		} else {
+			assert.Error(t, err)
+		}
+
+		_, err = getGitConfig("user.email")
+		assert.Error(t, err)
+		_, err = getGitConfig("core.sshCommand")
+		assert.Error(t, err)
+
+		output, err := runGitCommand("config", "--local", "--list")
+		require.NoError(t, err)
+		assert.NotContains(t, string(output), "gitprofile")
+	}
+
+	cmd := NewUnuseCmd()
+	err = cmd.RunE(cmd, []string{})
+	assert.Error(t, err)
+}
+
+func TestUseSwitchRemovesStaleKeys(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err := os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+
+	profiles := ProfileMap{
+		"work": {
+			Name:        "Work User",
+			Email:       "work@example.com",
+			GPGKey:      "ABC123",
+			SignCommits: boolPtr(true),
+			SSHKey:      "~/.ssh/id_work",
+		},
+		"personal": {
+			Name:  "Personal User",
+			Email: "me@example.com",
+		},
+	}
+
+	err = SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	cmd := NewUseCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	err = cmd.RunE(cmd, []string{"work"})
+	require.NoError(t, err)
+
+	cmd = NewUseCmd()
+	buffer := &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	err = cmd.RunE(cmd, []string{"personal"})
+	require.NoError(t, err)
+
+	_, err = getGitConfig("user.signingkey")
+	assert.Error(t, err)
+	_, err = getGitConfig("core.sshCommand")
+	assert.Error(t, err)
+
+	signCommits, err := getGitConfig("commit.gpgsign")
+	require.NoError(t, err)
+	assert.Equal(t, "false", signCommits)
+
+	output := buffer.String()
+	assert.Contains(t, output, "changed user.email: work@example.com -> me@example.com")
+	assert.Contains(t, output, "removed user.signingkey")
+	assert.Contains(t, output, "removed core.sshCommand")
+
+	// Removed keys are no longer owned, a value set by hand afterwards stays
+	state, err := loadRepoState("", scopeLocal)
+	require.NoError(t, err)
+	assert.False(t, state.IsManaged("user.signingkey"))
+
+	_, err = runGitCommand("config", "user.signingkey", "MANUAL")
+	require.NoError(t, err)
+
+	cmd = NewUseCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	err = cmd.RunE(cmd, []string{"personal"})
+	require.NoError(t, err)
+	signingKey, err := getGitConfig("user.signingkey")
+	require.NoError(t, err)
+	assert.Equal(t, "MANUAL", signingKey)
+
+	// A value set before gitprofile survives switching to a profile without
+	// that key, and is still there after unuse --restore
+	cmd = NewUseCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	err = cmd.RunE(cmd, []string{"work"})
+	require.NoError(t, err)
+
+	cmd = NewUseCmd()
+	buffer = &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	err = cmd.RunE(cmd, []string{"personal"})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "restored user.signingkey = MANUAL")
+
+	signingKey, err = getGitConfig("user.signingkey")
+	require.NoError(t, err)
+	assert.Equal(t, "MANUAL", signingKey)
+
+	unuseCmd := NewUnuseCmd()
+	unuseCmd.SetOut(&bytes.Buffer{})
+	require.NoError(t, unuseCmd.Flags().Set("restore", "true"))
+	err = unuseCmd.RunE(unuseCmd, []string{})
+	require.NoError(t, err)
+
+	signingKey, err = getGitConfig("user.signingkey")
+	require.NoError(t, err)
+	assert.Equal(t, "MANUAL", signingKey)
+}
+
+func TestUseDryRun(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err := os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+	_, err = runGitCommand("config", "--local", "user.name", "Old User")
+	require.NoError(t, err)
+
+	profiles := ProfileMap{
+		"testprofile": {
+			Name:  "Test User",
+			Email: "test@example.com",
+		},
+	}
+
+	err = SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	cmd := NewUseCmd()
+	buffer := &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	cmd.Flags().Set("dry-run", "true")
+	cmd.Flags().Set("output", "json")
+	err = cmd.RunE(cmd, []string{"testprofile"})
+	require.NoError(t, err)
+
+	var result useResult
+	err = json.Unmarshal(buffer.Bytes(), &result)
+	require.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Contains(t, result.Changes, configChange{Action: actionChange, Key: "user.name", Old: "Old User", New: "Test User"})
+	assert.Contains(t, result.Changes, configChange{Action: actionSet, Key: "user.email", New: "test@example.com"})
+
+	// Nothing may have been written
+	name, err := getGitConfig("user.name")
+	require.NoError(t, err)
+	assert.Equal(t, "Old User", name)
+	_, err = getGitConfig("user.email")
+	assert.Error(t, err)
+}
+
+func TestProfileGitConfig(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err := os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+
+	addCmd := NewAddCmd()
+	addCmd.Flags().Set("name", "Work User")
+	addCmd.Flags().Set("email", "work@example.com")
+	addCmd.Flags().Set("set", "pull.rebase=true")
+	addCmd.Flags().Set("set", "url.git@github.com:.insteadOf=https://github.com/")
+	err = addCmd.RunE(addCmd, []string{"work"})
+	require.NoError(t, err)
+
+	err = addCmd.Flags().Set("set", "invalid")
+	require.NoError(t, err)
+	err = addCmd.RunE(addCmd, []string{"work"})
+	assert.Error(t, err)
+
+	cmd := NewUseCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	err = cmd.RunE(cmd, []string{"work"})
+	require.NoError(t, err)
+
+	rebase, err := getGitConfig("pull.rebase")
+	require.NoError(t, err)
+	assert.Equal(t, "true", rebase)
+
+	insteadOf, err := getGitConfig("url.git@github.com:.insteadOf")
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/", insteadOf)
+
+	listCmd := NewListCmd()
+	buffer := &bytes.Buffer{}
+	listCmd.SetOut(buffer)
+	err = listCmd.RunE(listCmd, []string{})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "pull.rebase = true")
+}
+
+func TestUseSigningFormats(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err := os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+
+	signingKey := filepath.Join(tmpDir, "id_ed25519.pub")
+	err = os.WriteFile(signingKey, []byte("ssh-ed25519 AAAA test"), 0644)
+	require.NoError(t, err)
+
+	profiles := ProfileMap{
+		"ssh": {
+			Name:               "SSH User",
+			Email:              "ssh@example.com",
+			GPGKey:             signingKey,
+			SignCommits:        boolPtr(true),
+			SigningFormat:      SigningFormatSSH,
+			AllowedSignersFile: "~/.ssh/allowed_signers",
+		},
+		"missingkey": {
+			Name:          "SSH User",
+			Email:         "ssh@example.com",
+			GPGKey:        filepath.Join(tmpDir, "missing.pub"),
+			SignCommits:   boolPtr(true),
+			SigningFormat: SigningFormatSSH,
+		},
+		"x509": {
+			Name:          "X509 User",
+			Email:         "x509@example.com",
+			GPGKey:        "0xABC",
+			SignCommits:   boolPtr(true),
+			SigningFormat: SigningFormatX509,
+		},
+	}
+
+	err = SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	cmd := NewUseCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	err = cmd.RunE(cmd, []string{"missingkey"})
+	assert.Error(t, err)
+
+	err = cmd.RunE(cmd, []string{"ssh"})
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		"gpg.format":                 "ssh",
+		"user.signingkey":            signingKey,
+		"gpg.ssh.allowedSignersFile": "~/.ssh/allowed_signers",
+		"commit.gpgsign":             "true",
+		"tag.gpgsign":                "true",
+	}
+	for key, value := range expected {
+		got, err := getGitConfig(key)
+		require.NoError(t, err)
+		assert.Equal(t, value, got, key)
+	}
+
+	err = cmd.RunE(cmd, []string{"x509"})
+	require.NoError(t, err)
+
+	format, err := getGitConfig("gpg.format")
+	require.NoError(t, err)
+	assert.Equal(t, "x509", format)
+
+	program, err := getGitConfig("gpg.x509.program")
+	require.NoError(t, err)
+	assert.Equal(t, "gpgsm", program)
+
+	_, err = getGitConfig("gpg.ssh.allowedSignersFile")
+	assert.Error(t, err)
+}
+
+func TestUseGlobal(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	t.Chdir(tmpDir)
+
+	profiles := ProfileMap{
+		"work": {
+			Name:  "Work User",
+			Email: "work@example.com",
+		},
+		"personal": {
+			Name:  "Personal User",
+			Email: "me@example.com",
+		},
+	}
+
+	err := SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	_, err = runGitCommand("config", "--global", "user.email", "existing@example.com")
+	require.NoError(t, err)
+
+	cmd := NewUseCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.Flags().Set("global", "true")
+	err = cmd.RunE(cmd, []string{"work"})
+	assert.Error(t, err)
+
+	cmd.Flags().Set("force", "true")
+	err = cmd.RunE(cmd, []string{"work"})
+	require.NoError(t, err)
+
+	// Switching between profiles is not an override of a foreign identity
+	cmd.Flags().Set("force", "false")
+	err = cmd.RunE(cmd, []string{"personal"})
+	require.NoError(t, err)
+
+	output, err := runGitCommand("config", "--global", "user.email")
+	require.NoError(t, err)
+	assert.Equal(t, "me@example.com", strings.TrimSpace(string(output)))
+
+	unuseCmd := NewUnuseCmd()
+	unuseCmd.SetOut(&bytes.Buffer{})
+	unuseCmd.Flags().Set("global", "true")
+	unuseCmd.Flags().Set("restore", "true")
+	err = unuseCmd.RunE(unuseCmd, []string{})
+	require.NoError(t, err)
+
+	output, err = runGitCommand("config", "--global", "user.email")
+	require.NoError(t, err)
+	assert.Equal(t, "existing@example.com", strings.TrimSpace(string(output)))
+
+	// Worktree scope requires extensions.worktreeConfig
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err = os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+
+	cmd = NewUseCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.Flags().Set("worktree", "true")
+	err = cmd.RunE(cmd, []string{"work"})
+	assert.Error(t, err)
+
+	_, err = runGitCommand("config", "extensions.worktreeConfig", "true")
+	require.NoError(t, err)
+	err = cmd.RunE(cmd, []string{"work"})
+	require.NoError(t, err)
+
+	output, err = runGitCommand("config", "--worktree", "user.email")
+	require.NoError(t, err)
+	assert.Equal(t, "work@example.com", strings.TrimSpace(string(output)))
+}
+
+func TestStatusScopes(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	_, err := runGitCommand("init", "-q", repoDir)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+	_, err = runGitCommand("config", "extensions.worktreeConfig", "true")
+	require.NoError(t, err)
+
+	err = SaveProfiles(ProfileMap{
+		"work":     {Name: "Work User", Email: "work@example.com"},
+		"personal": {Name: "Personal User", Email: "me@example.com"},
+		"oss":      {Name: "OSS User", Email: "oss@example.com"},
+	})
+	require.NoError(t, err)
+
+	status := func() string {
+		cmd := NewStatusCmd()
+		buffer := &bytes.Buffer{}
+		cmd.SetOut(buffer)
+		err := cmd.RunE(cmd, []string{})
+		require.NoError(t, err)
+		return buffer.String()
+	}
+	use := func(name, scopeFlag string) {
+		cmd := NewUseCmd()
+		cmd.SetOut(&bytes.Buffer{})
+		if scopeFlag != "" {
+			cmd.Flags().Set(scopeFlag, "true")
+		}
+		err := cmd.RunE(cmd, []string{name})
+		require.NoError(t, err)
+	}
+
+	use("personal", "global")
+	assert.Contains(t, status(), "Active profile: personal (from global git config)")
+
+	use("oss", "")
+	assert.Contains(t, status(), "Active profile: oss (from repository config)")
+
+	use("work", "worktree")
+	assert.Contains(t, status(), "Active profile: work (from worktree config)")
+
+	recorded, scope, err := recordedProfile("")
+	require.NoError(t, err)
+	assert.Equal(t, "work", recorded)
+	assert.Equal(t, scopeWorktree, scope)
+}
+
+func TestDoctorCommand(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err := os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+
+	sshKey := filepath.Join(tmpDir, "id_work")
+	err = os.WriteFile(sshKey, []byte("key"), 0600)
+	require.NoError(t, err)
+
+	profiles := ProfileMap{
+		"work": {
+			Name:   "Work User",
+			Email:  "work@example.com",
+			SSHKey: sshKey,
+		},
+	}
+
+	err = SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	useCmd := NewUseCmd()
+	useCmd.SetOut(&bytes.Buffer{})
+	err = useCmd.RunE(useCmd, []string{"work"})
+	require.NoError(t, err)
+
+	cmd := NewDoctorCmd()
+	buffer := &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	err = cmd.RunE(cmd, []string{})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "[PASS] identity: user.email work@example.com belongs to profile 'work'")
+	assert.NotContains(t, buffer.String(), "FAIL")
+
+	// Signing without a key and a world readable ssh key must fail
+	_, err = runGitCommand("config", "--local", "commit.gpgsign", "true")
+	require.NoError(t, err)
+	err = os.Chmod(sshKey, 0644)
+	require.NoError(t, err)
+
+	buffer.Reset()
+	err = cmd.RunE(cmd, []string{})
+	assert.Error(t, err)
+	assert.Contains(t, buffer.String(), "[FAIL] signing key")
+	if runtime.GOOS != "windows" {
+		assert.Contains(t, buffer.String(), "[FAIL] ssh key")
+	}
+}
+
+func TestHookCommands(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err := os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+	_, err = runGitCommand("config", "core.hooksPath", "githooks")
+	require.NoError(t, err)
+
+	// An existing hook must be chained, not overwritten
+	hooksDir := filepath.Join(repoDir, "githooks")
+	err = os.MkdirAll(hooksDir, 0755)
+	require.NoError(t, err)
+	existing := "#!/bin/sh\necho existing\n"
+	err = os.WriteFile(filepath.Join(hooksDir, "pre-commit"), []byte(existing), 0755)
+	require.NoError(t, err)
+
+	installCmd := NewHookCmd()
+	installCmd.SetOut(&bytes.Buffer{})
+	installCmd.SetArgs([]string{"install"})
+	err = installCmd.Execute()
+	require.NoError(t, err)
+
+	hook, err := os.ReadFile(filepath.Join(hooksDir, "pre-commit"))
+	require.NoError(t, err)
+	assert.Contains(t, string(hook), hookMarker)
+	assert.Contains(t, string(hook), "hook check")
+
+	chained, err := os.ReadFile(filepath.Join(hooksDir, "pre-commit"+chainedHookExt))
+	require.NoError(t, err)
+	assert.Equal(t, existing, string(chained))
+
+	// Installing again keeps the chained hook intact
+	installCmd.SetArgs([]string{"install"})
+	err = installCmd.Execute()
+	require.NoError(t, err)
+
+	profiles := ProfileMap{
+		"work": {
+			Name:  "Work User",
+			Email: "work@example.com",
+		},
+	}
+
+	err = SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	err = checkRepositoryIdentity(&bytes.Buffer{})
+	assert.Error(t, err)
+
+	useCmd := NewUseCmd()
+	useCmd.SetOut(&bytes.Buffer{})
+	err = useCmd.RunE(useCmd, []string{"work"})
+	require.NoError(t, err)
+
+	err = checkRepositoryIdentity(&bytes.Buffer{})
+	assert.NoError(t, err)
+
+	_, err = runGitCommand("config", "--local", "user.email", "personal@example.com")
+	require.NoError(t, err)
+	err = checkRepositoryIdentity(&bytes.Buffer{})
+	assert.Error(t, err)
+
+	uninstallCmd := NewHookCmd()
+	uninstallCmd.SetOut(&bytes.Buffer{})
+	uninstallCmd.SetArgs([]string{"uninstall"})
+	err = uninstallCmd.Execute()
+	require.NoError(t, err)
+
+	hook, err = os.ReadFile(filepath.Join(hooksDir, "pre-commit"))
+	require.NoError(t, err)
+	assert.Equal(t, existing, string(hook))
+}
+
+func TestHookCheckScopes(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	err := SaveProfiles(ProfileMap{
+		"work":     {Name: "Work User", Email: "work@example.com"},
+		"personal": {Name: "Personal User", Email: "me@example.com"},
+		"oss":      {Name: "OSS User", Email: "oss@example.com"},
+		"bound":    {Name: "Bound User", Email: "bound@example.com"},
+	})
+	require.NoError(t, err)
+
+	use := func(name, scopeFlag string) {
+		cmd := NewUseCmd()
+		cmd.SetOut(&bytes.Buffer{})
+		if scopeFlag != "" {
+			cmd.Flags().Set(scopeFlag, "true")
+		}
+		err := cmd.RunE(cmd, []string{name})
+		require.NoError(t, err)
+	}
+
+	// A binding of the parent directory is enough
+	boundDir := filepath.Join(tmpDir, "bound")
+	boundRepo := filepath.Join(boundDir, "repo")
+	_, err = runGitCommand("init", "-q", boundRepo)
+	require.NoError(t, err)
+	t.Chdir(boundRepo)
+
+	bindCmd := NewBindCmd()
+	bindCmd.SetOut(&bytes.Buffer{})
+	err = bindCmd.RunE(bindCmd, []string{"bound", boundDir})
+	require.NoError(t, err)
+	assert.NoError(t, checkRepositoryIdentity(&bytes.Buffer{}))
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	_, err = runGitCommand("init", "-q", repoDir)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+	_, err = runGitCommand("config", "extensions.worktreeConfig", "true")
+	require.NoError(t, err)
+
+	use("personal", "global")
+	assert.NoError(t, checkRepositoryIdentity(&bytes.Buffer{}))
+
+	use("oss", "")
+	assert.NoError(t, checkRepositoryIdentity(&bytes.Buffer{}))
+
+	use("work", "worktree")
+	assert.NoError(t, checkRepositoryIdentity(&bytes.Buffer{}))
+
+	// An identity set by hand in a narrower scope than the recorded profile
+	_, err = runGitCommand("config", "--worktree", "user.email", "oss@example.com")
+	require.NoError(t, err)
+	_, err = runGitCommand("config", "--worktree", "user.name", "OSS User")
+	require.NoError(t, err)
+	err = checkRepositoryIdentity(&bytes.Buffer{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "belongs to profile 'oss', expected profile 'work'")
+}
+
+func TestAuditCommand(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err := os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+
+	profiles := ProfileMap{
+		"work": {
+			Name:  "Work User",
+			Email: "work@example.com",
+		},
+	}
+
+	err = SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	_, err = runGitCommand("-c", "user.name=Me", "-c", "user.email=me@personal.com", "commit", "--allow-empty", "-m", "leak")
+	require.NoError(t, err)
+	leak, err := runGitCommand("rev-parse", "HEAD")
+	require.NoError(t, err)
+
+	useCmd := NewUseCmd()
+	useCmd.SetOut(&bytes.Buffer{})
+	err = useCmd.RunE(useCmd, []string{"work"})
+	require.NoError(t, err)
+
+	_, err = runGitCommand("commit", "--allow-empty", "-m", "ok")
+	require.NoError(t, err)
+
+	cmd := NewAuditCmd()
+	buffer := &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	cmd.Flags().Set("output", "json")
+	err = cmd.RunE(cmd, []string{})
+	assert.Error(t, err)
+
+	var findings []auditFinding
+	err = json.Unmarshal(buffer.Bytes(), &findings)
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+	assert.Equal(t, strings.TrimSpace(string(leak)), findings[0].Commit)
+	assert.Equal(t, "author", findings[0].Field)
+	assert.Equal(t, "me@personal.com", findings[0].Found)
+	assert.Equal(t, "work@example.com", findings[0].Expected)
+	assert.Equal(t, "committer", findings[1].Field)
+
+	// Commits after the leak are clean
+	buffer.Reset()
+	cmd.Flags().Set("output", "table")
+	cmd.Flags().Set("since", "HEAD~1")
+	err = cmd.RunE(cmd, []string{})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "no problems found")
+
+	// Without --since only the commits not on the upstream are checked
+	_, err = runGitCommand("branch", "base", strings.TrimSpace(string(leak)))
+	require.NoError(t, err)
+	_, err = runGitCommand("branch", "--set-upstream-to", "base")
+	require.NoError(t, err)
+
+	buffer.Reset()
+	cmd = NewAuditCmd()
+	cmd.SetOut(buffer)
+	err = cmd.RunE(cmd, []string{})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "Checked 1 commit(s)")
+
+	// Signatures are only checked for profiles that sign commits
+	profiles["signed"] = Profile{Name: "Work User", Email: "work@example.com", GPGKey: "ABC123", SignCommits: boolPtr(true)}
+	err = SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	buffer.Reset()
+	cmd = NewAuditCmd()
+	cmd.SetOut(buffer)
+	cmd.Flags().Set("profile", "signed")
+	err = cmd.RunE(cmd, []string{})
+	assert.Error(t, err)
+	assert.Contains(t, buffer.String(), "unsigned")
+}
+
+func TestAuditExpectedProfileIgnoresIdentity(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err := os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+
+	profiles := ProfileMap{
+		"work": {
+			Name:    "Work User",
+			Email:   "work@example.com",
+			Remotes: []string{"github.com:acme/*"},
+		},
+		"personal": {
+			Name:  "Personal User",
+			Email: "me@example.com",
+		},
+	}
+
+	err = SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	// Without use, bind or a matching remote rule there is nothing to go by
+	_, err = runGitCommand("config", "user.name", "Personal User")
+	require.NoError(t, err)
+	_, err = runGitCommand("config", "user.email", "me@example.com")
+	require.NoError(t, err)
+	_, err = runGitCommand("commit", "--allow-empty", "-m", "leak")
+	require.NoError(t, err)
+
+	cmd := NewAuditCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	err = cmd.RunE(cmd, []string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "use --profile")
+
+	// The remote rules decide, not the personal identity the commit was made with
+	_, err = runGitCommand("remote", "add", "origin", "git@github.com:acme/api.git")
+	require.NoError(t, err)
+
+	buffer := &bytes.Buffer{}
+	cmd = NewAuditCmd()
+	cmd.SetOut(buffer)
+	err = cmd.RunE(cmd, []string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "against profile 'work'")
+	assert.Contains(t, buffer.String(), "me@example.com")
+}
+
+func TestFixCommitsCommand(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err := os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+
+	profiles := ProfileMap{
+		"work": {
+			Name:  "Work User",
+			Email: "work@example.com",
+		},
+	}
+
+	err = SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	for _, message := range []string{"base", "first", "second"} {
+		_, err = runGitCommand("-c", "user.name=Me", "-c", "user.email=me@personal.com", "commit", "--allow-empty", "-m", message)
+		require.NoError(t, err)
+	}
+	before, err := runGitCommand("rev-parse", "HEAD")
+	require.NoError(t, err)
+
+	// Commits on a remote-tracking branch must not be rewritten
+	_, err = runGitCommand("update-ref", "refs/remotes/origin/main", "HEAD~1")
+	require.NoError(t, err)
+
+	cmd := NewFixCommitsCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	err = cmd.RunE(cmd, []string{"work", "HEAD~2"})
+	assert.Error(t, err)
+
+	err = cmd.RunE(cmd, []string{"work", "origin/main..HEAD"})
+	require.NoError(t, err)
+
+	output, err := runGitCommand("log", "--format=%an <%ae> %cn <%ce>")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "Work User <work@example.com> Work User <work@example.com>", lines[0])
+	assert.Equal(t, "Me <me@personal.com> Me <me@personal.com>", lines[1])
+
+	// The old history is kept in a backup ref
+	output, err = runGitCommand("for-each-ref", "--format=%(objectname)", backupRefPrefix)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(string(before)), strings.TrimSpace(string(output)))
+
+	// A second backup never overwrites the first, even within the same second
+	first, err := createBackupRef()
+	require.NoError(t, err)
+	second, err := createBackupRef()
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	output, err = runGitCommand("for-each-ref", "--format=%(objectname)", backupRefPrefix)
+	require.NoError(t, err)
+	assert.Len(t, strings.Fields(string(output)), 3)
+	assert.Contains(t, string(output), strings.TrimSpace(string(before)))
+}
+
+func TestApplyCommand(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	t.Chdir(tmpDir)
+
+	profiles := ProfileMap{
+		"work": {
+			Name:  "Work User",
+			Email: "work@example.com",
+		},
+	}
+
+	err := SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	root := filepath.Join(tmpDir, "projects")
+	repos := []string{
+		filepath.Join(root, "alpha"),
+		filepath.Join(root, "beta"),
+		filepath.Join(root, "beta", "vendor", "nested"),
+	}
+	for _, repo := range repos {
+		_, err = runGitCommand("init", repo)
+		require.NoError(t, err)
+	}
+
+	// A linked worktree shares its config with the main repository
+	_, err = runGitCommandIn(repos[0], "-c", "user.name=Me", "-c", "user.email=me@example.com", "commit", "--allow-empty", "-m", "init")
+	require.NoError(t, err)
+	_, err = runGitCommandIn(repos[0], "worktree", "add", filepath.Join(root, "alpha-feature"))
+	require.NoError(t, err)
+
+	cmd := NewApplyCmd()
+	buffer := &bytes.Buffer{}
+	cmd.SetOut(buffer)
+
+	// Without --recursive the directory itself must be a repository
+	err = cmd.RunE(cmd, []string{"work", root})
+	assert.Error(t, err)
+
+	cmd.Flags().Set("recursive", "true")
+	cmd.Flags().Set("jobs", "2")
+	err = cmd.RunE(cmd, []string{"work", root})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "shares config with")
+	assert.Contains(t, buffer.String(), "applied to 4 repositories")
+
+	for _, repo := range repos {
+		output, err := runGitCommandIn(repo, "config", "--local", "user.email")
+		require.NoError(t, err)
+		assert.Equal(t, "work@example.com", strings.TrimSpace(string(output)))
+
+		output, err = runGitCommandIn(repo, "config", "--local", stateProfileKey)
+		require.NoError(t, err)
+		assert.Equal(t, "work", strings.TrimSpace(string(output)))
+	}
+
+	// Applying again changes nothing
+	buffer.Reset()
+	err = cmd.RunE(cmd, []string{"work", root})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "unchanged")
+	assert.NotContains(t, buffer.String(), "key(s) changed")
+}
+
+func TestScanCommand(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	t.Chdir(tmpDir)
+
+	profiles := ProfileMap{
+		"work": {
+			Name:  "Work User",
+			Email: "work@example.com",
+		},
+	}
+
+	err := SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	root := filepath.Join(tmpDir, "projects")
+	for _, repo := range []string{"bound", "custom", "matched", "unset", "worktree"} {
+		_, err = runGitCommand("init", filepath.Join(root, repo))
+		require.NoError(t, err)
+	}
+
+	_, err = applyProfile(filepath.Join(root, "matched"), "work", profiles["work"], scopeLocal)
+	require.NoError(t, err)
+	_, err = runGitCommandIn(filepath.Join(root, "custom"), "config", "user.email", "me@personal.com")
+	require.NoError(t, err)
+	_, err = runGitCommandIn(filepath.Join(root, "worktree"), "config", "extensions.worktreeConfig", "true")
+	require.NoError(t, err)
+	_, err = applyProfile(filepath.Join(root, "worktree"), "work", profiles["work"], scopeWorktree)
+	require.NoError(t, err)
+
+	bindCmd := NewBindCmd()
+	bindCmd.SetOut(&bytes.Buffer{})
+	err = bindCmd.RunE(bindCmd, []string{"work", filepath.Join(root, "bound")})
+	require.NoError(t, err)
+
+	cmd := NewScanCmd()
+	buffer := &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	cmd.Flags().Set("format", "json")
+	err = cmd.RunE(cmd, []string{root})
+	require.NoError(t, err)
+
+	var results []scanResult
+	err = json.Unmarshal(buffer.Bytes(), &results)
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+	assert.Equal(t, identityProfile, results[0].Status)
+	assert.Equal(t, "work", results[0].Profile)
+	assert.Equal(t, sourceBinding, results[0].Source)
+	assert.Equal(t, identityCustom, results[1].Status)
+	assert.Equal(t, "me@personal.com", results[1].Email)
+	assert.Equal(t, sourceLocal, results[1].Source)
+	assert.Equal(t, identityProfile, results[2].Status)
+	assert.Equal(t, "work", results[2].Profile)
+	assert.Equal(t, sourceLocal, results[2].Source)
+	assert.Equal(t, identityUnset, results[3].Status)
+	assert.Equal(t, identityProfile, results[4].Status)
+	assert.Equal(t, sourceWorktree, results[4].Source)
+
+	// The custom and the unset identity need attention, bound and worktree
+	// identities do not
+	buffer.Reset()
+	cmd.Flags().Set("format", "csv")
+	cmd.Flags().Set("mismatched-only", "true")
+	err = cmd.RunE(cmd, []string{root})
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "repository,status,source,profile,name,email,error", lines[0])
+	assert.Equal(t, filepath.Join(root, "custom")+",custom,local,,,me@personal.com,", lines[1])
+	assert.Equal(t, filepath.Join(root, "unset")+",unset,,,,,", lines[2])
+}
+
+func TestCloneCommand(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	t.Chdir(tmpDir)
+
+	profiles := ProfileMap{
+		"work": {
+			Name:    "Work User",
+			Email:   "jane@acme.com",
+			SSHKey:  "~/.ssh/id_work",
+			Remotes: []string{"github.com:acme/*"},
+		},
+		"personal": {
+			Name:  "Personal User",
+			Email: "jane@example.org",
+		},
+	}
+
+	err := SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	// Remote rules win over email domains
+	name, _, err := profileForURL(profiles, "git@github.com:acme/app.git")
+	require.NoError(t, err)
+	assert.Equal(t, "work", name)
+	name, _, err = profileForURL(profiles, "https://git.example.org/jane/dotfiles")
+	require.NoError(t, err)
+	assert.Equal(t, "personal", name)
+	_, _, err = profileForURL(profiles, "git@gitlab.com:other/app.git")
+	assert.Error(t, err)
+
+	dir, err := cloneDirectory("git@github.com:acme/app.git")
+	require.NoError(t, err)
+	assert.Equal(t, "app", dir)
+
+	origin := filepath.Join(tmpDir, "origin.git")
+	_, err = runGitCommand("init", "--bare", origin)
+	require.NoError(t, err)
+
+	cmd := NewCloneCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	err = cmd.RunE(cmd, []string{"work", origin, "app"})
+	require.NoError(t, err)
+
+	clone := filepath.Join(tmpDir, "app")
+	output, err := runGitCommandIn(clone, "config", "--local", "user.email")
+	require.NoError(t, err)
+	assert.Equal(t, "jane@acme.com", strings.TrimSpace(string(output)))
+	output, err = runGitCommandIn(clone, "config", "--local", "core.sshCommand")
+	require.NoError(t, err)
+	keyPath, err := expandPath("~/.ssh/id_work")
+	require.NoError(t, err)
+	assert.Equal(t, "ssh -i "+shellQuote(keyPath), strings.TrimSpace(string(output)))
+
+	// The key was not there before gitprofile, so unuse removes it
+	state, err := loadRepoState(clone, scopeLocal)
+	require.NoError(t, err)
+	assert.True(t, state.IsManaged("core.sshCommand"))
+	_, hadPrevious := state.PreviousValue("core.sshCommand")
+	assert.False(t, hadPrevious)
+}
+
+func TestSSHConfigSync(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("USERPROFILE", tmpDir)
+
+	repoDir := filepath.Join(tmpDir, "testrepo")
+	err := os.MkdirAll(repoDir, 0755)
+	require.NoError(t, err)
+	t.Chdir(repoDir)
+
+	_, err = runGitCommand("init")
+	require.NoError(t, err)
+	_, err = runGitCommand("remote", "add", "origin", "git@github.com:acme/app.git")
+	require.NoError(t, err)
+
+	profiles := ProfileMap{
+		"work": {
+			Name:   "Work User",
+			Email:  "work@example.com",
+			SSHKey: "~/.ssh/id_work",
+		},
+		"personal": {
+			Name:   "Personal User",
+			Email:  "me@example.com",
+			SSHKey: "~/.ssh/id_personal",
+		},
+	}
+
+	err = SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	sshConfig := filepath.Join(tmpDir, ".ssh", "config")
+	err = os.MkdirAll(filepath.Dir(sshConfig), 0700)
+	require.NoError(t, err)
+	userEntry := "Host example\n    HostName example.com\n"
+	err = os.WriteFile(sshConfig, []byte(userEntry), 0600)
+	require.NoError(t, err)
+
+	// Syncing twice must not duplicate the block or touch user entries
+	for i := 0; i < 2; i++ {
+		cmd := newSSHConfigSyncCmd()
+		cmd.SetOut(&bytes.Buffer{})
+		err = cmd.RunE(cmd, []string{})
+		require.NoError(t, err)
+	}
+
+	data, err := os.ReadFile(sshConfig)
+	require.NoError(t, err)
+	content := string(data)
+	assert.True(t, strings.HasPrefix(content, userEntry))
+	assert.Equal(t, 1, strings.Count(content, sshConfigBegin))
+	assert.Contains(t, content, "Host github.com-work\n    HostName github.com\n    IdentityFile ~/.ssh/id_work\n    IdentitiesOnly yes\n")
+	assert.True(t, sshConfigHasHost(content, "github.com-personal"))
+
+	// The file is replaced in one step, no temporary file is left behind
+	entries, err := os.ReadDir(filepath.Dir(sshConfig))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	info, err := os.Stat(sshConfig)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	useCmd := NewUseCmd()
+	buffer := &bytes.Buffer{}
+	useCmd.SetOut(buffer)
+	useCmd.Flags().Set("ssh-alias", "true")
+	err = useCmd.RunE(useCmd, []string{"work"})
+	require.NoError(t, err)
+	assert.NotContains(t, buffer.String(), "ssh-config sync")
+
+	output, err := runGitCommand("remote", "get-url", "origin")
+	require.NoError(t, err)
+	assert.Equal(t, "git@github.com-work:acme/app.git", strings.TrimSpace(string(output)))
+
+	// Switching profiles replaces the alias instead of stacking it
+	err = useCmd.RunE(useCmd, []string{"personal"})
+	require.NoError(t, err)
+	output, err = runGitCommand("remote", "get-url", "origin")
+	require.NoError(t, err)
+	assert.Equal(t, "git@github.com-personal:acme/app.git", strings.TrimSpace(string(output)))
+
+	// Using a profile without --ssh-alias puts the original URL back
+	useCmd = NewUseCmd()
+	useCmd.SetOut(&bytes.Buffer{})
+	err = useCmd.RunE(useCmd, []string{"work"})
+	require.NoError(t, err)
+	output, err = runGitCommand("remote", "get-url", "origin")
+	require.NoError(t, err)
+	assert.Equal(t, "git@github.com:acme/app.git", strings.TrimSpace(string(output)))
+
+	// So does unuse
+	useCmd = NewUseCmd()
+	useCmd.SetOut(&bytes.Buffer{})
+	useCmd.Flags().Set("ssh-alias", "true")
+	err = useCmd.RunE(useCmd, []string{"personal"})
+	require.NoError(t, err)
+	unuseCmd := NewUnuseCmd()
+	unuseCmd.SetOut(&bytes.Buffer{})
+	err = unuseCmd.RunE(unuseCmd, []string{})
+	require.NoError(t, err)
+	output, err = runGitCommand("remote", "get-url", "origin")
+	require.NoError(t, err)
+	assert.Equal(t, "git@github.com:acme/app.git", strings.TrimSpace(string(output)))
+
+	// Only aliases of the managed block are replaced, real hosts are kept
+	hosts := managedSSHHosts()
+	assert.Equal(t, "github.com", hosts["github.com-work"])
+	aliased, err := aliasRemoteURL("git@github.com-mirror:acme/app.git", "work", hosts)
+	require.NoError(t, err)
+	assert.Equal(t, "git@github.com-mirror-work:acme/app.git", aliased)
+	aliased, err = aliasRemoteURL("git@github.com-personal:acme/app.git", "work", hosts)
+	require.NoError(t, err)
+	assert.Equal(t, "git@github.com-work:acme/app.git", aliased)
+
+	aliased, err = aliasRemoteURL("ssh://git@gitlab.com:2222/acme/app.git", "work", hosts)
+	require.NoError(t, err)
+	assert.Equal(t, "ssh://git@gitlab.com-work:2222/acme/app.git", aliased)
+	_, err = aliasRemoteURL("https://github.com/acme/app.git", "work", hosts)
+	assert.Error(t, err)
+}
+
+func TestProfileSSHCommand(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	keyPath := filepath.Join(tmpDir, "my keys", "id_it's")
+	profile := Profile{
+		Name:              "Work User",
+		Email:             "work@example.com",
+		SSHKey:            keyPath,
+		SSHProgram:        "/usr/local/bin/ssh",
+		SSHPort:           2222,
+		SSHIdentitiesOnly: boolPtr(true),
+		SSHOptions:        []string{"StrictHostKeyChecking=accept-new", "ProxyJump=bastion example"},
+	}
+
+	command, err := profile.sshCommand()
+	require.NoError(t, err)
+	words, err := splitShellWords(command)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/usr/local/bin/ssh",
+		"-i", keyPath,
+		"-o", "IdentitiesOnly=yes",
+		"-p", "2222",
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "ProxyJump=bastion example",
+	}, words)
+	assert.Equal(t, keyPath, sshIdentityFile(command))
+
+	// A profile without ssh settings does not touch core.sshCommand
+	command, err = Profile{Name: "n", Email: "e"}.sshCommand()
+	require.NoError(t, err)
+	assert.Empty(t, command)
+
+	invalid := []Profile{
+		{SSHKey: "~/.ssh/id\nrm -rf ~"},
+		{SSHKey: "~/.ssh/id", SSHPort: 70000},
+		{SSHKey: "~/.ssh/id", SSHOptions: []string{"-F /tmp/evil"}},
+		{SSHIdentitiesOnly: boolPtr(true)},
+	}
+	for _, p := range invalid {
+		assert.Error(t, p.checkSSH(), "%+v", p)
+	}
+}
+
+func TestConcurrentProfileUpdates(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// Concurrent updates must not lose each other's profiles
+	const writers = 8
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		go func(i int) {
+			errs <- UpdateProfiles(func(profiles ProfileMap) error {
+				profiles["profile"+strconv.Itoa(i)] = Profile{Name: "User", Email: "user@example.com"}
+				return nil
+			})
+		}(i)
+	}
+	for i := 0; i < writers; i++ {
+		require.NoError(t, <-errs)
+	}
+
+	profiles, err := LoadProfiles()
+	require.NoError(t, err)
+	assert.Len(t, profiles, writers)
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), ".tmp-")
+	}
+
+	// A change by another process between load and save is detected
+	configPath, err := GetConfigPath()
+	require.NoError(t, err)
+	err = os.WriteFile(configPath, []byte(`{"other": {"name": "Other", "email": "other@example.com"}}`), 0644)
+	require.NoError(t, err)
+
+	profiles["late"] = Profile{Name: "Late", Email: "late@example.com"}
+	err = SaveProfiles(profiles)
+	assert.ErrorIs(t, err, ErrProfilesModified)
+
+	profiles, err = LoadProfiles()
+	require.NoError(t, err)
+	assert.Contains(t, profiles, "other")
+	assert.NotContains(t, profiles, "late")
+}
+
+func TestConfigMigrations(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	legacy := `{
+  "work": {"name": "Work User", "email": "work@example.com", "sign_commits": false},
+  "version": {"name": "Version User", "email": "version@example.com", "sign_commits": false}
+}`
+
+	// Step 1 -> 2: a profile called "version" must not be taken for the field
+	version, err := configVersion([]byte(legacy))
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	migrated, err := migrateBareProfileMap([]byte(legacy))
+	require.NoError(t, err)
+	version, err = configVersion(migrated)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	doc, err := decodeConfig([]byte(legacy))
+	require.NoError(t, err)
+	assert.Equal(t, "work@example.com", doc.Profiles["work"].Email)
+	assert.Equal(t, "version@example.com", doc.Profiles["version"].Email)
+
+	// An empty legacy file is an empty document
+	doc, err = decodeConfig(nil)
+	require.NoError(t, err)
+	assert.Empty(t, doc.Profiles)
+
+	// Files from a newer gitprofile are refused instead of being downgraded
+	_, err = decodeConfig([]byte(`{"version": 99, "profiles": {}}`))
+	assert.Error(t, err)
+
+	configPath := filepath.Join(tmpDir, ".gitprofiles.json")
+	err = os.WriteFile(configPath, []byte(legacy), 0644)
+	require.NoError(t, err)
+
+	cmd := newConfigMigrateCmd()
+	buffer := &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	cmd.Flags().Set("dry-run", "true")
+	err = cmd.RunE(cmd, []string{})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "version 1 -> 2")
+
+	data, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, legacy, string(data))
+
+	cmd.Flags().Set("dry-run", "false")
+	err = cmd.RunE(cmd, []string{})
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(configPath + ".v1.bak")
+	require.NoError(t, err)
+	assert.Equal(t, legacy, string(data))
+
+	data, err = os.ReadFile(configPath)
+	require.NoError(t, err)
+	var written configDocument
+	err = json.Unmarshal(data, &written)
+	require.NoError(t, err)
+	assert.Equal(t, currentConfigVersion, written.Version)
+	assert.Len(t, written.Profiles, 2)
+
+	// Settings survive saving the profiles
+	err = os.WriteFile(configPath, []byte(`{"version": 2, "settings": {"default_ssh_host": "gitlab.com"}, "profiles": {}}`), 0644)
+	require.NoError(t, err)
+	err = UpdateProfiles(func(profiles ProfileMap) error {
+		profiles["work"] = Profile{Name: "Work User", Email: "work@example.com"}
+		return nil
+	})
+	require.NoError(t, err)
+	settings, err := LoadSettings()
+	require.NoError(t, err)
+	assert.Equal(t, "gitlab.com", settings.DefaultSSHHost)
+}
+
+func TestConfigPath(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	SetTestConfigPath("")
+
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("USERPROFILE", tmpDir)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv(configEnvVar, "")
+
+	legacyPath := filepath.Join(tmpDir, ".gitprofiles.json")
+	xdgHome := filepath.Join(tmpDir, "xdg")
+	xdgPath := filepath.Join(xdgHome, "gitprofile", "profiles.json")
+
+	path, _, err := ResolveConfigPath()
+	require.NoError(t, err)
+	assert.Equal(t, legacyPath, path)
+
+	t.Setenv("XDG_CONFIG_HOME", xdgHome)
+	path, _, err = ResolveConfigPath()
+	require.NoError(t, err)
+	assert.Equal(t, xdgPath, path)
+
+	// An existing file in the home directory keeps being used
+	err = os.WriteFile(legacyPath, []byte("{}"), 0644)
+	require.NoError(t, err)
+	path, _, err = ResolveConfigPath()
+	require.NoError(t, err)
+	assert.Equal(t, legacyPath, path)
+
+	err = os.MkdirAll(filepath.Dir(xdgPath), 0755)
+	require.NoError(t, err)
+	err = os.WriteFile(xdgPath, []byte("{}"), 0644)
+	require.NoError(t, err)
+	path, reason, err := ResolveConfigPath()
+	require.NoError(t, err)
+	assert.Equal(t, xdgPath, path)
+	assert.Contains(t, reason, "XDG")
+
+	envPath := filepath.Join(tmpDir, "env.json")
+	t.Setenv(configEnvVar, envPath)
+	path, reason, err = ResolveConfigPath()
+	require.NoError(t, err)
+	assert.Equal(t, envPath, path)
+	assert.Contains(t, reason, configEnvVar)
+
+	// The flag wins over everything else
+	flagPath := filepath.Join(tmpDir, "flag.json")
+	configFlagPath = flagPath
+	defer func() { configFlagPath = "" }()
+
+	cmd := newConfigPathCmd()
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.SetOut(stdout)
+	cmd.SetErr(stderr)
+	err = cmd.RunE(cmd, []string{})
+	require.NoError(t, err)
+	assert.Equal(t, flagPath+"\n", stdout.String())
+	assert.Contains(t, stderr.String(), "--config")
+
+	// Relative paths are resolved against the current directory
+	t.Chdir(tmpDir)
+	configFlagPath = "flag.json"
+	path, _, err = ResolveConfigPath()
+	require.NoError(t, err)
+	assert.Equal(t, flagPath, path)
+
+	configFlagPath = ""
+	t.Setenv(configEnvVar, filepath.Join("nested", "..", "env.json"))
+	path, _, err = ResolveConfigPath()
+	require.NoError(t, err)
+	assert.Equal(t, envPath, path)
+}
+
+func TestProfileInheritance(t *testing.T) {
+	_, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	profiles := ProfileMap{
+		"base": {
+			Name:        "John Doe",
+			Email:       "john@example.com",
+			GPGKey:      "ABC123",
+			SignCommits: boolPtr(true),
+			GitConfig:   map[string]string{"pull.rebase": "true", "core.autocrlf": "input"},
+		},
+		"company": {
+			Extends:   "base",
+			SSHKey:    "~/.ssh/id_company",
+			GitConfig: map[string]string{"core.autocrlf": "false"},
+		},
+		"work": {
+			Extends: "company",
+			Email:   "john@company.com",
+		},
+	}
+
+	err := SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	loaded, err := LoadProfiles()
+	require.NoError(t, err)
+	work := loaded["work"]
+	assert.Equal(t, "John Doe", work.Name)
+	assert.Equal(t, "john@company.com", work.Email)
+	assert.Equal(t, "ABC123", work.GPGKey)
+	assert.True(t, work.signsCommits())
+	assert.Equal(t, "~/.ssh/id_company", work.SSHKey)
+	assert.Equal(t, map[string]string{"pull.rebase": "true", "core.autocrlf": "false"}, work.GitConfig)
+
+	// The stored profile keeps only its own fields
+	raw, err := LoadRawProfiles()
+	require.NoError(t, err)
+	assert.Empty(t, raw["work"].Name)
+
+	_, origins, err := resolveProfile(raw, "work")
+	require.NoError(t, err)
+	assert.Equal(t, "base", origins[fieldName])
+	assert.Equal(t, "work", origins[fieldEmail])
+	assert.Equal(t, "base", origins[fieldSigning])
+	assert.Equal(t, "company", origins[fieldSSH])
+	assert.Equal(t, "company", origins[gitConfigField("core.autocrlf")])
+
+	cmd := NewShowCmd()
+	buffer := &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	cmd.Flags().Set("resolved", "true")
+	err = cmd.RunE(cmd, []string{"work"})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "Inherits: work -> company -> base")
+	assert.Regexp(t, `Name:\s+John Doe\s+\(from base\)`, buffer.String())
+	assert.Regexp(t, `Email:\s+john@company.com\s+\(own\)`, buffer.String())
+
+	// An explicit false wins over the true of an ancestor, keeping its key
+	err = UpdateProfiles(func(profiles ProfileMap) error {
+		profiles["unsigned"] = Profile{Extends: "work", SignCommits: boolPtr(false)}
+		return nil
+	})
+	require.NoError(t, err)
+	loaded, err = LoadProfiles()
+	require.NoError(t, err)
+	assert.False(t, loaded["unsigned"].signsCommits())
+	assert.Equal(t, "ABC123", loaded["unsigned"].GPGKey)
+	assert.True(t, loaded["work"].signsCommits())
+
+	// Version 2 wrote false for every profile, meaning unset
+	doc, err := decodeConfig([]byte(`{"version": 2, "profiles": {"base": {"name": "John Doe", "email": "john@example.com", "sign_commits": true}, "work": {"extends": "base", "sign_commits": false}}}`))
+	require.NoError(t, err)
+	assert.Nil(t, doc.Profiles["work"].SignCommits)
+	assert.True(t, doc.Profiles["base"].signsCommits())
+
+	// Cycles and unknown parents are rejected
+	profiles["base"] = Profile{Extends: "work", Name: "John Doe", Email: "john@example.com"}
+	err = SaveProfiles(profiles)
+	assert.ErrorContains(t, err, "cycle")
+
+	err = UpdateProfiles(func(profiles ProfileMap) error {
+		profiles["broken"] = Profile{Extends: "missing"}
+		return nil
+	})
+	assert.ErrorContains(t, err, "unknown profile 'missing'")
+}
+
+func TestProfileRegistry(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeDoc := func(path string, doc configDocument) {
+		data, err := encodeConfig(&doc)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0644))
+	}
+
+	writeDoc(systemRegistryPath, configDocument{Profiles: ProfileMap{
+		"company": {Name: "Company Default", Email: "dev@company.com", SignCommits: boolPtr(true)},
+		"shared":  {Name: "System Shared", Email: "system@company.com"},
+	}})
+	teamPath := filepath.Join(tmpDir, "team.json")
+	writeDoc(teamPath, configDocument{Profiles: ProfileMap{
+		"shared": {Name: "Team Shared", Email: "team@company.com"},
+	}})
+	configPath := filepath.Join(tmpDir, ".gitprofiles.json")
+	writeDoc(configPath, configDocument{
+		Settings: Settings{Registries: []string{"team.json"}},
+		Profiles: ProfileMap{
+			"work": {Extends: "company", Email: "john@company.com"},
+		},
+	})
+
+	profiles, err := LoadProfiles()
+	require.NoError(t, err)
+	require.Len(t, profiles, 3)
+	assert.Equal(t, "Team Shared", profiles["shared"].Name)
+	assert.Equal(t, teamPath, profiles["shared"].Origin)
+	assert.Equal(t, systemRegistryPath, profiles["company"].Origin)
+	assert.False(t, profiles["work"].readOnly())
+	assert.Equal(t, "Company Default", profiles["work"].Name)
+	assert.True(t, profiles["work"].signsCommits())
+
+	cmd := NewListCmd()
+	buffer := &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	err = cmd.RunE(cmd, []string{})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "Origin: "+systemRegistryPath+" (read-only)")
+	assert.Contains(t, buffer.String(), "Origin: "+configPath+"\n")
+
+	// Registry profiles cannot be deleted
+	cmd = NewDeleteCmd()
+	err = cmd.RunE(cmd, []string{"company"})
+	assert.ErrorContains(t, err, "read-only registry")
+
+	// Saving never writes registry profiles into the user's file
+	err = UpdateProfiles(func(profiles ProfileMap) error {
+		profiles["shared"] = Profile{Name: "My Shared", Email: "me@example.com"}
+		return nil
+	})
+	require.NoError(t, err)
+
+	doc, err := readConfig(configPath)
+	require.NoError(t, err)
+	assert.Len(t, doc.Profiles, 2)
+	assert.Contains(t, doc.Profiles, "shared")
+	assert.NotContains(t, doc.Profiles, "company")
+	assert.Equal(t, []string{"team.json"}, doc.Settings.Registries)
+
+	profiles, err = LoadProfiles()
+	require.NoError(t, err)
+	assert.Equal(t, "My Shared", profiles["shared"].Name)
+	assert.False(t, profiles["shared"].readOnly())
+}
+
+func TestExportImport(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	profiles := ProfileMap{
+		"base": {
+			Name:        "John \"JD\" Doe",
+			Email:       "john@example.com",
+			GPGKey:      "ABC123",
+			SignCommits: boolPtr(true),
+			SSHKey:      "~/.ssh/id_base",
+			SSHPort:     2222,
+			SSHOptions:  []string{"IdentityFile=~/.ssh/other", "ServerAliveInterval=30"},
+			Remotes:     []string{"github.com/example/*"},
+			GitConfig:   map[string]string{"pull.rebase": "true"},
+		},
+		"work": {
+			Extends:            "base",
+			Email:              "john@company.com",
+			GPGKey:             "~/.ssh/id_sign.pub",
+			SigningFormat:      SigningFormatSSH,
+			AllowedSignersFile: "~/.ssh/allowed_signers",
+			SSHProgram:         "/usr/local/bin/ssh",
+			GitConfig: map[string]string{
+				"user.signingKey":     "~/.ssh/id_sign.pub",
+				"gpg.ssh.program":     "/usr/bin/ssh-keygen",
+				"core.sshCommand":     "ssh -i ~/.ssh/id_work",
+				"gpg.program":         "/usr/bin/gpg2",
+				"merge.conflictStyle": "zdiff3",
+			},
+		},
+		"personal": {
+			Name:  "John Doe",
+			Email: "john@personal.com",
+		},
+	}
+	err := SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	export := func(format string, args ...string) string {
+		cmd := NewExportCmd()
+		buffer := &bytes.Buffer{}
+		cmd.SetOut(buffer)
+		cmd.Flags().Set("format", format)
+		err := cmd.RunE(cmd, args)
+		require.NoError(t, err)
+		return buffer.String()
+	}
+
+	runImport := func(path string, conflict string) (string, error) {
+		cmd := NewImportCmd()
+		buffer := &bytes.Buffer{}
+		cmd.SetOut(buffer)
+		cmd.Flags().Set("conflict", conflict)
+		err := cmd.RunE(cmd, []string{path})
+		return buffer.String(), err
+	}
+
+	// Every format round-trips into an empty profiles file
+	for _, format := range profileFormats {
+		path := filepath.Join(tmpDir, "export."+format)
+		require.NoError(t, os.WriteFile(path, []byte(export(format)), 0644))
+
+		SetTestConfigPath(filepath.Join(tmpDir, format, "profiles.json"))
+		_, err := runImport(path, conflictSkip)
+		require.NoError(t, err, format)
+
+		imported, err := LoadRawProfiles()
+		require.NoError(t, err)
+		assert.Equal(t, profiles, imported, format)
+	}
+	SetTestConfigPath(filepath.Join(tmpDir, ".gitprofiles.json"))
+
+	assert.Contains(t, export("toml"), "[profiles.base.git_config]\n\"pull.rebase\" = \"true\"\n")
+
+	// Named exports include the profiles they extend, redacted on request
+	cmd := NewExportCmd()
+	buffer := &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	cmd.Flags().Set("redact", "true")
+	err = cmd.RunE(cmd, []string{"work"})
+	require.NoError(t, err)
+	redacted, err := decodeProfiles(buffer.Bytes(), "json")
+	require.NoError(t, err)
+	require.Len(t, redacted, 2)
+	assert.Empty(t, redacted["base"].GPGKey)
+	assert.Empty(t, redacted["base"].SSHKey)
+	assert.Equal(t, []string{"ServerAliveInterval=30"}, redacted["base"].SSHOptions)
+	assert.Nil(t, redacted["base"].SignCommits)
+	assert.Equal(t, "john@company.com", redacted["work"].Email)
+	assert.Empty(t, redacted["work"].AllowedSignersFile)
+	assert.Empty(t, redacted["work"].SSHProgram)
+	assert.Empty(t, redacted["work"].SigningFormat)
+	assert.Equal(t, map[string]string{"merge.conflictStyle": "zdiff3"}, redacted["work"].GitConfig)
+
+	path := filepath.Join(tmpDir, "work.json")
+	require.NoError(t, os.WriteFile(path, buffer.Bytes(), 0644))
+
+	output, err := runImport(path, conflictSkip)
+	require.NoError(t, err)
+	assert.Contains(t, output, "Skipped 'work'")
+
+	output, err = runImport(path, conflictRename)
+	require.NoError(t, err)
+	assert.Contains(t, output, "Imported 'work' as 'work-imported'")
+	loaded, err := LoadRawProfiles()
+	require.NoError(t, err)
+	assert.Equal(t, "base-imported", loaded["work-imported"].Extends)
+
+	_, err = runImport(path, conflictOverwrite)
+	require.NoError(t, err)
+	loaded, err = LoadRawProfiles()
+	require.NoError(t, err)
+	assert.Empty(t, loaded["base"].GPGKey)
+
+	// Signing settings are checked like add does
+	unsigned := filepath.Join(tmpDir, "unsigned.json")
+	err = os.WriteFile(unsigned, []byte(`{"version": 3, "profiles": {"ssh": {"name": "SSH", "email": "ssh@example.com", "signing_format": "ssh", "sign_commits": true}}}`), 0644)
+	require.NoError(t, err)
+	_, err = runImport(unsigned, conflictSkip)
+	assert.ErrorContains(t, err, "ssh signing requires a signing key")
+
+	// Nothing is saved if any profile is invalid
+	invalid := filepath.Join(tmpDir, "invalid.yaml")
+	err = os.WriteFile(invalid, []byte("version: 2\nprofiles:\n  good:\n    name: Good\n    email: good@example.com\n  bad:\n    name: Bad\n"), 0644)
+	require.NoError(t, err)
+	_, err = runImport(invalid, conflictSkip)
+	assert.ErrorContains(t, err, "profile 'bad'")
+	loaded, err = LoadRawProfiles()
+	require.NoError(t, err)
+	assert.NotContains(t, loaded, "good")
+}
+
+func TestImportFromGit(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+	t.Chdir(tmpDir)
+
+	setConfig := func(file string, args ...string) {
+		_, err := runGitCommand(append([]string{"config", "--file", file}, args...)...)
+		require.NoError(t, err)
+	}
+
+	globalConfig := filepath.Join(tmpDir, ".gitconfig")
+	setConfig(globalConfig, "user.name", "John Doe")
+	setConfig(globalConfig, "user.email", "john@personal.com")
+	setConfig(globalConfig, "includeIf.gitdir:~/work/.path", "work.gitconfig")
+	workConfig := filepath.Join(tmpDir, "work.gitconfig")
+	setConfig(workConfig, "user.email", "john@company.com")
+	setConfig(workConfig, "core.sshCommand", "ssh -i ~/.ssh/id_work -o IdentitiesOnly=yes")
+
+	reposDir := filepath.Join(tmpDir, "repos")
+	for _, name := range []string{"oss", "plain"} {
+		_, err := runGitCommand("init", "-q", filepath.Join(reposDir, name))
+		require.NoError(t, err)
+	}
+	_, err := runGitCommandIn(filepath.Join(reposDir, "oss"), "config", "user.email", "john@oss.dev")
+	require.NoError(t, err)
+
+	identities, err := collectGitIdentities(reposDir)
+	require.NoError(t, err)
+	require.Len(t, identities, 3)
+	assert.Equal(t, []string{globalConfig, filepath.Join(reposDir, "plain")}, identities[0].Sources)
+	assert.Equal(t, "john@company.com", identities[1].Email)
+	assert.Equal(t, "John Doe", identities[1].Name)
+	assert.Equal(t, []string{filepath.Join(reposDir, "oss")}, identities[2].Sources)
+
+	err = SaveProfiles(ProfileMap{"personal": {Name: "John Doe", Email: "john@personal.com"}})
+	require.NoError(t, err)
+
+	cmd := NewImportCmd()
+	buffer := &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	cmd.Flags().Set("from-git", "true")
+	cmd.Flags().Set("yes", "true")
+	err = cmd.RunE(cmd, []string{reposDir})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "John Doe <john@personal.com> is already profile 'personal'")
+
+	profiles, err := LoadRawProfiles()
+	require.NoError(t, err)
+	require.Len(t, profiles, 3)
+	assert.Equal(t, "~/.ssh/id_work", profiles["company"].SSHKey)
+	assert.True(t, profiles["company"].identitiesOnly())
+	assert.Equal(t, "john@oss.dev", profiles["oss"].Email)
+
+	// Names are asked for unless --yes is given, invalid ones again
+	SetTestConfigPath(filepath.Join(tmpDir, "interactive.json"))
+	cmd = NewImportCmd()
+	buffer = &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	cmd.SetIn(strings.NewReader("my home\nhome\n-\n\n"))
+	cmd.Flags().Set("from-git", "true")
+	err = cmd.RunE(cmd, []string{reposDir})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "Profile name [personal] (- to skip): ")
+	assert.Contains(t, buffer.String(), "invalid profile name 'my home'")
+
+	profiles, err = LoadRawProfiles()
+	require.NoError(t, err)
+	require.Len(t, profiles, 2)
+	assert.Equal(t, "john@personal.com", profiles["home"].Email)
+	assert.Equal(t, "john@oss.dev", profiles["oss"].Email)
+
+	// Profiles saved by another invocation while prompting are kept
+	SetTestConfigPath(filepath.Join(tmpDir, "concurrent.json"))
+	cmd = NewImportCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetIn(&saveWhileReading{r: strings.NewReader("home\n-\n\n"), save: func() {
+		err := UpdateProfiles(func(profiles ProfileMap) error {
+			profiles["other"] = Profile{Name: "Other", Email: "other@example.com"}
+			return nil
+		})
+		require.NoError(t, err)
+	}})
+	cmd.Flags().Set("from-git", "true")
+	err = cmd.RunE(cmd, []string{reposDir})
+	require.NoError(t, err)
+
+	profiles, err = LoadRawProfiles()
+	require.NoError(t, err)
+	require.Len(t, profiles, 3)
+	assert.Contains(t, profiles, "other")
+	assert.Contains(t, profiles, "home")
+
+	// Every value of include.path is followed, in file order
+	for _, name := range []string{"first", "second"} {
+		setConfig(globalConfig, "--add", "include.path", name+".gitconfig")
+		setConfig(filepath.Join(tmpDir, name+".gitconfig"), "user.email", "john@"+name+".dev")
+	}
+	identities, err = collectGitIdentities("")
+	require.NoError(t, err)
+	var emails []string
+	for _, id := range identities {
+		emails = append(emails, id.Email)
+	}
+	assert.Equal(t, []string{"john@personal.com", "john@company.com", "john@first.dev", "john@second.dev"}, emails)
+}
+
+func TestRenameAndCopyProfile(t *testing.T) {
+	tmpDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	profiles := ProfileMap{
+		"base": {Name: "John Doe", Email: "john@example.com"},
+		"work": {
+			Extends:   "base",
+			Email:     "john@company.com",
+			Remotes:   []string{"github.com/company/*"},
+			GitConfig: map[string]string{"pull.rebase": "true"},
+			SSHKey:    "~/.ssh/id_work",
+		},
+	}
+	err := SaveProfiles(profiles)
+	require.NoError(t, err)
+
+	reposDir := filepath.Join(tmpDir, "repos")
+	current := filepath.Join(reposDir, "current")
+	other := filepath.Join(reposDir, "other")
+	for _, repo := range []string{current, other} {
+		_, err := runGitCommand("init", "-q", repo)
+		require.NoError(t, err)
+	}
+	_, err = runGitCommandIn(other, "config", stateProfileKey, "work")
+	require.NoError(t, err)
+	elsewhere := filepath.Join(tmpDir, "elsewhere")
+	_, err = runGitCommand("init", "-q", elsewhere)
+	require.NoError(t, err)
+	_, err = runGitCommandIn(elsewhere, "config", stateProfileKey, "work")
+	require.NoError(t, err)
+
+	t.Chdir(current)
+	_, err = runGitCommand("remote", "add", "origin", "git@github.com:acme/api.git")
+	require.NoError(t, err)
+	useCmd := NewUseCmd()
+	useCmd.SetOut(&bytes.Buffer{})
+	useCmd.Flags().Set("ssh-alias", "true")
+	err = useCmd.RunE(useCmd, []string{"work"})
+	require.NoError(t, err)
+
+	bindCmd := NewBindCmd()
+	bindCmd.SetOut(&bytes.Buffer{})
+	err = bindCmd.RunE(bindCmd, []string{"work", filepath.Join(tmpDir, "bound")})
+	require.NoError(t, err)
+
+	cmd := NewRenameCmd()
+	buffer := &bytes.Buffer{}
+	cmd.SetOut(buffer)
+	cmd.Flags().Set("scan", reposDir)
+	err = cmd.RunE(cmd, []string{"work", "job"})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "Profile 'work' renamed to 'job'")
+	assert.Contains(t, buffer.String(), "Other repositories may still record 'work'")
+
+	loaded, err := LoadRawProfiles()
+	require.NoError(t, err)
+	assert.NotContains(t, loaded, "work")
+	assert.Equal(t, "john@company.com", loaded["job"].Email)
+
+	for _, repo := range []string{current, other} {
+		recorded, _, err := getConfigValueIn(repo, scopeLocal, stateProfileKey)
+		require.NoError(t, err)
+		assert.Equal(t, "job", recorded, repo)
+	}
+
+	bindings, err := ListBindings()
+	require.NoError(t, err)
+	require.Len(t, bindings, 1)
+	assert.Equal(t, "job", bindings[0].Profile)
+	oldInclude, err := getIncludePath("work")
+	require.NoError(t, err)
+	assert.NoFileExists(t, oldInclude)
+
+	// Remotes aliased with use --ssh-alias follow the new host alias
+	output, err := runGitCommand("remote", "get-url", "origin")
+	require.NoError(t, err)
+	assert.Equal(t, "git@github.com-job:acme/api.git", strings.TrimSpace(string(output)))
+	assert.Contains(t, buffer.String(), "remote.origin.url: git@github.com-work:acme/api.git -> git@github.com-job:acme/api.git")
+
+	// The hook of a missed repository warns instead of refusing every commit
+	t.Chdir(elsewhere)
+	_, err = runGitCommand("config", "user.name", "John Doe")
+	require.NoError(t, err)
+	_, err = runGitCommand("config", "user.email", "john@company.com")
+	require.NoError(t, err)
+	buffer.Reset()
+	assert.NoError(t, checkRepositoryIdentity(buffer))
+	assert.Contains(t, buffer.String(), "run 'gitprofile rename work <new-name> --scan <dir>'")
+
+	_, err = runGitCommand("config", "user.email", "me@personal.com")
+	require.NoError(t, err)
+	assert.Error(t, checkRepositoryIdentity(&bytes.Buffer{}))
+	_, err = runGitCommand("config", "user.email", "john@company.com")
+	require.NoError(t, err)
+
+	statusCmd := NewStatusCmd()
+	buffer.Reset()
+	statusCmd.SetOut(buffer)
+	err = statusCmd.RunE(statusCmd, []string{})
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "rename work <new-name> --scan <dir>")
+	t.Chdir(current)
+
+	// Renaming again updates the repositories that were missed
+	err = renameProfile(&bytes.Buffer{}, "work", "job", []string{elsewhere})
+	require.NoError(t, err)
+	recorded, _, err := getConfigValueIn(elsewhere, scopeLocal, stateProfileKey)
+	require.NoError(t, err)
+	assert.Equal(t, "job", recorded)
+
+	// Names end up in include files and ssh host aliases
+	for _, name := range []string{"my job", "../job", "-job", ""} {
+		err = renameProfile(&bytes.Buffer{}, "job", name, nil)
+		assert.Error(t, err, name)
+	}
+	err = copyProfile("job", "job/copy", "")
+	assert.Error(t, err)
+
+	// Profiles extending a renamed profile follow it
+	err = renameProfile(&bytes.Buffer{}, "base", "root", nil)
+	require.NoError(t, err)
+	loaded, err = LoadRawProfiles()
+	require.NoError(t, err)
+	assert.Equal(t, "root", loaded["job"].Extends)
+
+	err = renameProfile(&bytes.Buffer{}, "job", "root", nil)
+	assert.ErrorContains(t, err, "already exists")
+
+	cmd = NewCopyCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.Flags().Set("email", "john@contractor.com")
+	err = cmd.RunE(cmd, []string{"job", "contract"})
+	require.NoError(t, err)
+
+	resolved, err := LoadProfiles()
+	require.NoError(t, err)
+	assert.Equal(t, "John Doe", resolved["contract"].Name)
+	assert.Equal(t, "john@contractor.com", resolved["contract"].Email)
+	assert.Equal(t, "true", resolved["contract"].GitConfig["pull.rebase"])
+	assert.Empty(t, resolved["contract"].Remotes)
+	assert.Equal(t, "john@company.com", resolved["job"].Email)
+}
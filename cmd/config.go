@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// currentConfigVersion is the schema version written by SaveProfiles.
+// Version 1 is the legacy file holding a bare profile map.
+const currentConfigVersion = 3
+
+// Settings holds options that apply to all profiles.
+type Settings struct {
+	// DefaultSSHHost is the host ssh-config sync creates aliases for when a
+	// profile's remote rules name none (default github.com).
+	DefaultSSHHost string `json:"default_ssh_host,omitempty"`
+
+	// Registries are shared, read-only profiles files merged under the
+	// user's profiles, earlier entries taking precedence over later ones.
+	Registries []string `json:"registries,omitempty"`
+}
+
+// configDocument is the content of the profiles file.
+type configDocument struct {
+	Version  int        `json:"version"`
+	Settings Settings   `json:"settings"`
+	Profiles ProfileMap `json:"profiles"`
+}
+
+// configMigration upgrades the raw profiles file from one version to the
+// next.
+type configMigration struct {
+	From        int
+	Description string
+	Migrate     func(data []byte) ([]byte, error)
+}
+
+// configMigrations are applied in order, starting at the version of the file.
+var configMigrations = []configMigration{
+	{
+		From:        1,
+		Description: "wrap the profile map in a versioned document",
+		Migrate:     migrateBareProfileMap,
+	},
+	{
+		From:        2,
+		Description: "leave sign_commits unset instead of false, so it can be inherited",
+		Migrate:     migrateUnsetSignCommits,
+	},
+}
+
+// migrateBareProfileMap turns the legacy {"name": {...}} map into a version 2
+// document.
+func migrateBareProfileMap(data []byte) ([]byte, error) {
+	var profiles map[string]json.RawMessage
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &profiles); err != nil {
+			return nil, err
+		}
+	}
+	if profiles == nil {
+		profiles = make(map[string]json.RawMessage)
+	}
+
+	return json.Marshal(map[string]any{
+		"version":  2,
+		"settings": map[string]any{},
+		"profiles": profiles,
+	})
+}
+
+// migrateUnsetSignCommits removes sign_commits: false from all profiles.
+// Version 2 wrote it for every profile without signing, where it meant the
+// value was not set, while in version 3 it overrides a true of the profile
+// being extended.
+func migrateUnsetSignCommits(data []byte) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var profiles map[string]map[string]json.RawMessage
+	if raw, ok := doc["profiles"]; ok {
+		if err := json.Unmarshal(raw, &profiles); err != nil {
+			return nil, err
+		}
+	}
+	for _, profile := range profiles {
+		if value, ok := profile["sign_commits"]; ok && string(bytes.TrimSpace(value)) == "false" {
+			delete(profile, "sign_commits")
+		}
+	}
+
+	if profiles != nil {
+		rawProfiles, err := json.Marshal(profiles)
+		if err != nil {
+			return nil, err
+		}
+		doc["profiles"] = rawProfiles
+	}
+	doc["version"] = json.RawMessage("3")
+	return json.Marshal(doc)
+}
+
+// configVersion returns the schema version of the raw profiles file. Files
+// without a numeric top-level version are legacy profile maps, where a
+// "version" key would be a profile object.
+func configVersion(data []byte) (int, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return 1, nil
+	}
+
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return 0, err
+	}
+
+	raw, ok := top["version"]
+	if !ok {
+		return 1, nil
+	}
+	var version int
+	if err := json.Unmarshal(raw, &version); err != nil {
+		return 1, nil
+	}
+	return version, nil
+}
+
+// migrateConfig upgrades raw profiles file content to the current version and
+// returns the descriptions of the steps applied.
+func migrateConfig(data []byte) ([]byte, []string, error) {
+	version, err := configVersion(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version > currentConfigVersion {
+		return nil, nil, fmt.Errorf("profiles file has version %d, this gitprofile only supports up to version %d", version, currentConfigVersion)
+	}
+
+	var steps []string
+	for _, migration := range configMigrations {
+		if migration.From != version {
+			continue
+		}
+		data, err = migration.Migrate(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to migrate from version %d: %w", version, err)
+		}
+		steps = append(steps, fmt.Sprintf("version %d -> %d: %s", version, version+1, migration.Description))
+		version++
+	}
+
+	if version != currentConfigVersion {
+		return nil, nil, fmt.Errorf("no migration from version %d", version)
+	}
+	return data, steps, nil
+}
+
+// decodeConfig parses the raw profiles file, migrating older versions in
+// memory.
+func decodeConfig(data []byte) (*configDocument, error) {
+	migrated, _, err := migrateConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc configDocument
+	if err := json.Unmarshal(migrated, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Profiles == nil {
+		doc.Profiles = make(ProfileMap)
+	}
+	return &doc, nil
+}
+
+// encodeConfig returns the file content of a document in the current version.
+func encodeConfig(doc *configDocument) ([]byte, error) {
+	doc.Version = currentConfigVersion
+	if doc.Profiles == nil {
+		doc.Profiles = make(ProfileMap)
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// LoadSettings returns the settings stored in the profiles file.
+func LoadSettings() (Settings, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return Settings{}, err
+	}
+
+	doc, err := readConfig(configPath)
+	if err != nil {
+		return Settings{}, err
+	}
+	return doc.Settings, nil
+}
+
+func newConfigMigrateCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the profiles file to the current format",
+		Long: `Rewrite the profiles file in the current format. Older formats are read
+transparently and upgraded on the next save, this command does it right away.
+The previous file is kept with a .v<version>.bak suffix. With --dry-run the
+steps and the resulting file are printed without writing anything.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configPath, err := GetConfigPath()
+			if err != nil {
+				return err
+			}
+
+			unlock, err := lockProfiles(configPath)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				if os.IsNotExist(err) {
+					fmt.Fprintf(cmd.OutOrStdout(), "No profiles file at %s, nothing to migrate\n", configPath)
+					return nil
+				}
+				return fmt.Errorf("failed to read profiles: %w", err)
+			}
+
+			version, err := configVersion(data)
+			if err != nil {
+				return fmt.Errorf("failed to read profiles: %w", err)
+			}
+
+			migrated, steps, err := migrateConfig(data)
+			if err != nil {
+				return err
+			}
+
+			w := cmd.OutOrStdout()
+
+			if len(steps) == 0 {
+				fmt.Fprintf(w, "%s is already at version %d\n", configPath, version)
+				return nil
+			}
+
+			doc, err := decodeConfig(migrated)
+			if err != nil {
+				return err
+			}
+			output, err := encodeConfig(doc)
+			if err != nil {
+				return err
+			}
+
+			for _, step := range steps {
+				fmt.Fprintf(w, "  %s\n", step)
+			}
+
+			if dryRun {
+				fmt.Fprintf(w, "Would write %s:\n%s\n", configPath, output)
+				return nil
+			}
+
+			backupPath := fmt.Sprintf("%s.v%d.bak", configPath, version)
+			if err := os.WriteFile(backupPath, data, 0600); err != nil {
+				return fmt.Errorf("failed to write backup: %w", err)
+			}
+			if err := writeFileAtomic(configPath, output, 0644); err != nil {
+				return fmt.Errorf("failed to save profiles: %w", err)
+			}
+			rememberChecksum(configPath, output)
+
+			fmt.Fprintf(w, "Migrated %s to version %d (backup at %s)\n", configPath, currentConfigVersion, backupPath)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the migration without writing the file")
+
+	return cmd
+}
+
+func newConfigPathCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "path",
+		Short: "Print the profiles file in use",
+		Long: `Print the profiles file gitprofile reads and writes, and why it was chosen.
+The first of these wins: the --config flag, the GITPROFILE_CONFIG environment
+variable, $XDG_CONFIG_HOME/gitprofile/profiles.json (~/.config/gitprofile/ if
+unset) when it exists, ~/.gitprofiles.json when it exists. A new file is
+created in the XDG location if XDG_CONFIG_HOME is set, else in the home
+directory. A relative --config or GITPROFILE_CONFIG is resolved against the
+current directory and the absolute path is printed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, reason, err := ResolveConfigPath()
+			if err != nil {
+				return fmt.Errorf("failed to locate profiles file: %w", err)
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), path)
+			fmt.Fprintf(cmd.ErrOrStderr(), "(%s)\n", reason)
+			return nil
+		},
+	}
+}
+
+func NewConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the profiles file",
+		Long:  `Inspect and maintain the file the profiles are stored in`,
+	}
+
+	cmd.AddCommand(
+		newConfigPathCmd(),
+		newConfigMigrateCmd(),
+	)
+
+	return cmd
+}
@@ -10,23 +10,23 @@ func NewDeleteCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "delete [profile-name]",
 		Short: "Delete a git profile",
-		Long:  `Delete a saved git profile from ~/.gitprofiles.json`,
+		Long:  `Delete a saved git profile from the profiles file`,
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			profileName := args[0]
-			profiles, err := LoadProfiles()
+			err := UpdateProfiles(func(profiles ProfileMap) error {
+				profile, exists := profiles[profileName]
+				if !exists {
+					return fmt.Errorf("profile '%s' not found", profileName)
+				}
+				if profile.readOnly() {
+					return errReadOnlyProfile(profileName, profile)
+				}
+				delete(profiles, profileName)
+				return nil
+			})
 			if err != nil {
-				return fmt.Errorf("failed to load profiles: %w", err)
-			}
-
-			if _, exists := profiles[profileName]; !exists {
-				return fmt.Errorf("profile '%s' not found", profileName)
-			}
-
-			delete(profiles, profileName)
-
-			if err := SaveProfiles(profiles); err != nil {
-				return fmt.Errorf("failed to save profiles: %w", err)
+				return err
 			}
 
 			fmt.Printf("Profile '%s' deleted successfully\n", profileName)
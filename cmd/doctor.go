@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "PASS"
+	checkWarn checkStatus = "WARN"
+	checkFail checkStatus = "FAIL"
+)
+
+// checkResult is the outcome of a single doctor check.
+type checkResult struct {
+	Name    string
+	Status  checkStatus
+	Message string
+	Hint    string
+}
+
+// doctorContext holds what the checks need to know about the environment.
+type doctorContext struct {
+	profiles ProfileMap
+	inRepo   bool
+}
+
+// effectiveValue returns the value git uses for key in the current directory.
+func effectiveValue(key string) (string, bool, error) {
+	return getConfigValue("", key)
+}
+
+func checkEmailMatchesProfile(ctx doctorContext) checkResult {
+	result := checkResult{Name: "identity"}
+
+	email, exists, err := effectiveValue("user.email")
+	if err != nil {
+		result.Status, result.Message = checkFail, fmt.Sprintf("failed to read user.email: %v", err)
+		return result
+	}
+	if !exists {
+		result.Status, result.Message = checkFail, "user.email is not set"
+		result.Hint = "run 'gitprofile use <profile>' or 'gitprofile use --global <profile>'"
+		return result
+	}
+
+	for name, profile := range ctx.profiles {
+		if profile.Email == email {
+			result.Status, result.Message = checkPass, fmt.Sprintf("user.email %s belongs to profile '%s'", email, name)
+			return result
+		}
+	}
+
+	result.Status, result.Message = checkWarn, fmt.Sprintf("user.email %s does not match any saved profile", email)
+	result.Hint = "activate a saved profile or add one with 'gitprofile add'"
+	return result
+}
+
+func checkScopeConflicts(ctx doctorContext) checkResult {
+	result := checkResult{Name: "scopes"}
+
+	if !ctx.inRepo {
+		result.Status, result.Message = checkPass, "not in a repository, only global config applies"
+		return result
+	}
+
+	var conflicts []string
+	for _, key := range []string{"user.name", "user.email"} {
+		global, globalSet, err := getConfigValue(scopeGlobal, key)
+		if err != nil {
+			result.Status, result.Message = checkFail, fmt.Sprintf("failed to read global %s: %v", key, err)
+			return result
+		}
+		local, localSet, err := getConfigValue(scopeLocal, key)
+		if err != nil {
+			result.Status, result.Message = checkFail, fmt.Sprintf("failed to read local %s: %v", key, err)
+			return result
+		}
+		if globalSet && localSet && global != local {
+			conflicts = append(conflicts, fmt.Sprintf("%s (global '%s', local '%s')", key, global, local))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		result.Status = checkWarn
+		result.Message = "local config overrides global " + strings.Join(conflicts, ", ")
+		result.Hint = "make sure the local identity is intended, 'gitprofile status' shows the active profile"
+		return result
+	}
+
+	result.Status, result.Message = checkPass, "global and local identity do not conflict"
+	return result
+}
+
+func checkSigningKey(ctx doctorContext) checkResult {
+	result := checkResult{Name: "signing key"}
+
+	key, keySet, err := effectiveValue("user.signingkey")
+	if err != nil {
+		result.Status, result.Message = checkFail, fmt.Sprintf("failed to read user.signingkey: %v", err)
+		return result
+	}
+
+	sign, err := getConfigBool("commit.gpgsign")
+	if err != nil {
+		result.Status, result.Message = checkFail, fmt.Sprintf("failed to read commit.gpgsign: %v", err)
+		return result
+	}
+
+	if !keySet {
+		if sign {
+			result.Status, result.Message = checkFail, "commit.gpgsign is enabled but no user.signingkey is set"
+			result.Hint = "add a signing key to the profile with --gpg-key or disable signing"
+			return result
+		}
+		result.Status, result.Message = checkPass, "commit signing is not configured"
+		return result
+	}
+
+	format, _, err := effectiveValue("gpg.format")
+	if err != nil {
+		result.Status, result.Message = checkFail, fmt.Sprintf("failed to read gpg.format: %v", err)
+		return result
+	}
+
+	switch format {
+	case SigningFormatSSH:
+		if strings.HasPrefix(key, "key::") {
+			result.Status, result.Message = checkPass, "ssh signing uses a literal public key"
+			return result
+		}
+		path, err := expandPath(key)
+		if err == nil {
+			_, err = os.Stat(path)
+		}
+		if err != nil {
+			result.Status, result.Message = checkFail, fmt.Sprintf("ssh signing key %s not found", key)
+			result.Hint = "point the profile's --gpg-key at an existing key file"
+			return result
+		}
+		result.Status, result.Message = checkPass, fmt.Sprintf("ssh signing key %s exists", key)
+	case SigningFormatX509:
+		result.Status, result.Message = checkPass, "x509 signing keys are not checked"
+	default:
+		program, _, err := effectiveValue("gpg.program")
+		if err != nil || program == "" {
+			program = "gpg"
+		}
+		if _, err := exec.LookPath(program); err != nil {
+			result.Status, result.Message = checkWarn, fmt.Sprintf("%s not found, cannot verify signing key %s", program, key)
+			result.Hint = "install GnuPG or set gpg.program"
+			return result
+		}
+		if err := exec.Command(program, "--list-secret-keys", key).Run(); err != nil {
+			result.Status, result.Message = checkFail, fmt.Sprintf("signing key %s is not in the gpg keyring", key)
+			result.Hint = "import the secret key with 'gpg --import' or fix the profile's --gpg-key"
+			return result
+		}
+		result.Status, result.Message = checkPass, fmt.Sprintf("signing key %s found in gpg keyring", key)
+	}
+
+	return result
+}
+
+// sshIdentityFile extracts the -i argument of an ssh command.
+func sshIdentityFile(command string) string {
+	words, err := splitShellWords(command)
+	if err != nil {
+		return ""
+	}
+	for i, word := range words {
+		if word == "-i" && i+1 < len(words) {
+			return words[i+1]
+		}
+	}
+	return ""
+}
+
+func checkSSHKey(ctx doctorContext) checkResult {
+	result := checkResult{Name: "ssh key"}
+
+	command, exists, err := effectiveValue("core.sshCommand")
+	if err != nil {
+		result.Status, result.Message = checkFail, fmt.Sprintf("failed to read core.sshCommand: %v", err)
+		return result
+	}
+
+	keyPath := sshIdentityFile(command)
+	if !exists || keyPath == "" {
+		result.Status, result.Message = checkPass, "no ssh key configured"
+		return result
+	}
+
+	path, err := expandPath(keyPath)
+	if err != nil {
+		result.Status, result.Message = checkFail, fmt.Sprintf("invalid ssh key path %s: %v", keyPath, err)
+		return result
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		result.Status, result.Message = checkFail, fmt.Sprintf("ssh key %s not found", keyPath)
+		result.Hint = "fix the profile's --ssh-key or create the key with ssh-keygen"
+		return result
+	}
+
+	// ssh refuses private keys that other users can read
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		result.Status = checkFail
+		result.Message = fmt.Sprintf("ssh key %s has permissions %04o", keyPath, info.Mode().Perm())
+		result.Hint = fmt.Sprintf("run 'chmod 600 %s'", path)
+		return result
+	}
+
+	result.Status, result.Message = checkPass, fmt.Sprintf("ssh key %s exists", keyPath)
+	return result
+}
+
+// runDoctorChecks runs all checks in a fixed order.
+func runDoctorChecks(ctx doctorContext) []checkResult {
+	checks := []func(doctorContext) checkResult{
+		checkEmailMatchesProfile,
+		checkScopeConflicts,
+		checkSigningKey,
+		checkSSHKey,
+	}
+
+	results := make([]checkResult, 0, len(checks))
+	for _, check := range checks {
+		results = append(results, check(ctx))
+	}
+	return results
+}
+
+func printCheckResults(w io.Writer, results []checkResult) {
+	for _, result := range results {
+		fmt.Fprintf(w, "[%s] %s: %s\n", result.Status, result.Name, result.Message)
+		if result.Hint != "" && result.Status != checkPass {
+			fmt.Fprintf(w, "       hint: %s\n", result.Hint)
+		}
+	}
+}
+
+func NewDoctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the git identity setup for problems",
+		Long: `Inspect the current repository and machine for identity problems: whether the
+effective user.email belongs to a saved profile, whether global and local
+values conflict, whether the signing key and SSH key exist and whether commit
+signing is enabled without a key. Exits with a non-zero status on failures.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profiles, err := LoadProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to load profiles: %w", err)
+			}
+
+			_, err = runGitCommand("rev-parse", "--git-dir")
+			ctx := doctorContext{profiles: profiles, inRepo: err == nil}
+
+			results := runDoctorChecks(ctx)
+			printCheckResults(cmd.OutOrStdout(), results)
+
+			failures := 0
+			for _, result := range results {
+				if result.Status == checkFail {
+					failures++
+				}
+			}
+			if failures > 0 {
+				return fmt.Errorf("%d check(s) failed", failures)
+			}
+
+			return nil
+		},
+	}
+
+	return cmd
+}
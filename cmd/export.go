@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// exportDocument is the content written by export. It is a profiles file
+// without settings, so an export can also be used as a profiles file or a
+// registry.
+type exportDocument struct {
+	Version  int        `json:"version"`
+	Profiles ProfileMap `json:"profiles"`
+}
+
+// profileFormats are the file formats export writes and import reads.
+var profileFormats = []string{"json", "yaml", "toml"}
+
+func validateProfileFormat(format string) error {
+	for _, supported := range profileFormats {
+		if format == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid format '%s' (must be json, yaml or toml)", format)
+}
+
+// formatFromPath returns the format matching the extension of path, json if
+// the extension is unknown.
+func formatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	default:
+		return "json"
+	}
+}
+
+// toGeneric converts v to nested maps through its JSON encoding, so the
+// json field names are used in every format. Integers stay int64.
+func toGeneric(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc map[string]any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return normalizeNumbers(doc).(map[string]any), nil
+}
+
+func normalizeNumbers(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, item := range value {
+			value[key] = normalizeNumbers(item)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = normalizeNumbers(item)
+		}
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return n
+		}
+		f, _ := value.Float64()
+		return f
+	}
+	return v
+}
+
+// encodeProfiles returns the profiles in the given format.
+func encodeProfiles(profiles ProfileMap, format string) ([]byte, error) {
+	doc := exportDocument{Version: currentConfigVersion, Profiles: profiles}
+
+	if format == "json" {
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+
+	generic, err := toGeneric(doc)
+	if err != nil {
+		return nil, err
+	}
+	if format == "yaml" {
+		return yaml.Marshal(generic)
+	}
+
+	var buffer bytes.Buffer
+	encoder := toml.NewEncoder(&buffer)
+	encoder.Indent = ""
+	if err := encoder.Encode(generic); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// decodeProfiles parses profiles written by export, or a profiles file in
+// any version, in the given format.
+func decodeProfiles(data []byte, format string) (ProfileMap, error) {
+	var generic any
+	switch format {
+	case "yaml":
+		if err := yaml.Unmarshal(data, &generic); err != nil {
+			return nil, err
+		}
+	case "toml":
+		var doc map[string]any
+		if _, err := toml.Decode(string(data), &doc); err != nil {
+			return nil, err
+		}
+		generic = doc
+	}
+
+	if generic != nil {
+		var err error
+		if data, err = json.Marshal(generic); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, err := decodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Profiles, nil
+}
+
+// redactedGitConfigKey reports whether an extra git config key holds a key,
+// a key path or a program path.
+func redactedGitConfigKey(key string) bool {
+	key = strings.ToLower(key)
+	switch {
+	case key == "user.signingkey", key == "core.sshcommand":
+		return true
+	case strings.HasPrefix(key, "gpg.ssh."):
+		return true
+	case strings.HasPrefix(key, "gpg.") && strings.HasSuffix(key, ".program"):
+		return true
+	}
+	return false
+}
+
+// redactProfile removes the keys, key IDs and paths of a profile, which are
+// specific to one machine or person. Signing is turned off with the key, as
+// it cannot work without one.
+func redactProfile(p Profile) Profile {
+	hadSigningKey := p.GPGKey != ""
+	p.GPGKey = ""
+	p.AllowedSignersFile = ""
+	p.X509Program = ""
+	p.SSHKey = ""
+	p.SSHProgram = ""
+	p.SSHIdentitiesOnly = nil
+
+	var gitConfig map[string]string
+	for key, value := range p.GitConfig {
+		if redactedGitConfigKey(key) {
+			hadSigningKey = hadSigningKey || strings.EqualFold(key, "user.signingkey")
+			continue
+		}
+		if gitConfig == nil {
+			gitConfig = make(map[string]string)
+		}
+		gitConfig[key] = value
+	}
+	p.GitConfig = gitConfig
+
+	if hadSigningKey {
+		p.SignCommits = nil
+		if p.SigningFormat == SigningFormatSSH {
+			p.SigningFormat = ""
+		}
+	}
+
+	var options []string
+	for _, option := range p.SSHOptions {
+		keyword, _, _ := strings.Cut(option, "=")
+		switch strings.ToLower(keyword) {
+		case "identityfile", "certificatefile":
+			continue
+		}
+		options = append(options, option)
+	}
+	p.SSHOptions = options
+
+	return p
+}
+
+// exportProfiles selects the named profiles, or all of the user's own if
+// none are named, together with the profiles they extend so the export can
+// be imported on its own.
+func exportProfiles(profiles ProfileMap, names []string) (ProfileMap, error) {
+	if len(names) == 0 {
+		for name, profile := range profiles {
+			if !profile.readOnly() {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+
+	selected := make(ProfileMap)
+	for _, name := range names {
+		if _, exists := profiles[name]; !exists {
+			return nil, fmt.Errorf("profile '%s' not found", name)
+		}
+		chain, err := extendsChain(profiles, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ancestor := range chain {
+			profile := profiles[ancestor]
+			profile.Origin = ""
+			selected[ancestor] = profile
+		}
+	}
+
+	return selected, nil
+}
+
+func NewExportCmd() *cobra.Command {
+	var format string
+	var redact bool
+
+	cmd := &cobra.Command{
+		Use:   "export [profile-name...]",
+		Short: "Export profiles to share or move them",
+		Long: `Write profiles to stdout as JSON, YAML or TOML, for 'gitprofile import' on
+another machine. Without names all profiles of the profiles file are exported.
+Profiles the exported ones extend are always included. With --redact signing
+keys, SSH keys, allowed signers files, SSH and signing programs and the git
+config keys holding any of them are left out, and signing is turned off where
+its key was removed.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateProfileFormat(format); err != nil {
+				return err
+			}
+
+			profiles, err := LoadRawProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to load profiles: %w", err)
+			}
+
+			selected, err := exportProfiles(profiles, args)
+			if err != nil {
+				return err
+			}
+			if redact {
+				for name, profile := range selected {
+					selected[name] = redactProfile(profile)
+				}
+			}
+
+			data, err := encodeProfiles(selected, format)
+			if err != nil {
+				return fmt.Errorf("failed to encode profiles: %w", err)
+			}
+
+			_, err = cmd.OutOrStdout().Write(data)
+			return err
+		},
+		ValidArgsFunction: ValidProfileArgs,
+	}
+
+	cmd.Flags().StringVar(&format, "format", "json", "Output format (json, yaml or toml)")
+	cmd.Flags().BoolVar(&redact, "redact", false, "Leave out keys, key paths and program paths")
+	cmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return profileFormats, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return cmd
+}
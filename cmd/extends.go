@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fields of a resolved profile whose origin is tracked. Signing and SSH
+// settings are inherited as a group, so a profile either uses all of its own
+// or all of its parent's. Their booleans are inherited on their own, so a
+// profile can turn signing on or off and keep the key of its parent.
+const (
+	fieldName              = "name"
+	fieldEmail             = "email"
+	fieldSigning           = "signing"
+	fieldSignCommits       = "sign_commits"
+	fieldSSH               = "ssh"
+	fieldSSHIdentitiesOnly = "ssh_identities_only"
+)
+
+// gitConfigField returns the origin key of an extra git config key.
+func gitConfigField(key string) string {
+	return "git_config." + key
+}
+
+// fieldOrigins maps a field of a resolved profile to the profile it came from.
+type fieldOrigins map[string]string
+
+// hasSigning reports whether the profile configures signing itself.
+func (p Profile) hasSigning() bool {
+	return p.GPGKey != "" || p.SigningFormat != "" || p.AllowedSignersFile != "" || p.X509Program != ""
+}
+
+// hasSSH reports whether the profile configures ssh itself.
+func (p Profile) hasSSH() bool {
+	return p.SSHKey != "" || p.SSHProgram != "" || p.SSHPort != 0 || len(p.SSHOptions) > 0
+}
+
+// extendsChain returns the profile followed by its ancestors, failing on
+// unknown parents and cycles.
+func extendsChain(profiles ProfileMap, name string) ([]string, error) {
+	chain := []string{name}
+	seen := map[string]bool{name: true}
+
+	for current := name; profiles[current].Extends != ""; {
+		parent := profiles[current].Extends
+		if seen[parent] {
+			return nil, fmt.Errorf("profile inheritance cycle: %s -> %s", strings.Join(chain, " -> "), parent)
+		}
+		if _, exists := profiles[parent]; !exists {
+			return nil, fmt.Errorf("profile '%s' extends unknown profile '%s'", current, parent)
+		}
+		seen[parent] = true
+		chain = append(chain, parent)
+		current = parent
+	}
+
+	return chain, nil
+}
+
+// resolveProfile returns the profile with the fields it leaves unset filled
+// in from its ancestors, and the profile each field came from. Remote rules
+// are never inherited, as they select one specific profile.
+func resolveProfile(profiles ProfileMap, name string) (Profile, fieldOrigins, error) {
+	if _, exists := profiles[name]; !exists {
+		return Profile{}, nil, fmt.Errorf("profile '%s' not found", name)
+	}
+
+	chain, err := extendsChain(profiles, name)
+	if err != nil {
+		return Profile{}, nil, err
+	}
+
+	var resolved Profile
+	origins := make(fieldOrigins)
+
+	// Apply the root ancestor first so closer profiles override it
+	for i := len(chain) - 1; i >= 0; i-- {
+		owner := chain[i]
+		p := profiles[owner]
+
+		if p.Name != "" {
+			resolved.Name, origins[fieldName] = p.Name, owner
+		}
+		if p.Email != "" {
+			resolved.Email, origins[fieldEmail] = p.Email, owner
+		}
+		if p.hasSigning() {
+			resolved.GPGKey = p.GPGKey
+			resolved.SigningFormat = p.SigningFormat
+			resolved.AllowedSignersFile = p.AllowedSignersFile
+			resolved.X509Program = p.X509Program
+			origins[fieldSigning] = owner
+		}
+		if p.hasSSH() {
+			resolved.SSHKey = p.SSHKey
+			resolved.SSHProgram = p.SSHProgram
+			resolved.SSHPort = p.SSHPort
+			resolved.SSHOptions = p.SSHOptions
+			origins[fieldSSH] = owner
+		}
+		// An explicit false overrides a true of an ancestor
+		if p.SignCommits != nil {
+			resolved.SignCommits, origins[fieldSignCommits] = p.SignCommits, owner
+		}
+		if p.SSHIdentitiesOnly != nil {
+			resolved.SSHIdentitiesOnly, origins[fieldSSHIdentitiesOnly] = p.SSHIdentitiesOnly, owner
+		}
+		for key, value := range p.GitConfig {
+			if resolved.GitConfig == nil {
+				resolved.GitConfig = make(map[string]string)
+			}
+			resolved.GitConfig[key] = value
+			origins[gitConfigField(key)] = owner
+		}
+	}
+
+	own := profiles[name]
+	resolved.Remotes = own.Remotes
+	resolved.Extends = own.Extends
+	resolved.Origin = own.Origin
+
+	return resolved, origins, nil
+}
+
+// resolveProfiles resolves the inheritance of every profile.
+func resolveProfiles(profiles ProfileMap) (ProfileMap, error) {
+	resolved := make(ProfileMap, len(profiles))
+	for name := range profiles {
+		profile, _, err := resolveProfile(profiles, name)
+		if err != nil {
+			return nil, err
+		}
+		resolved[name] = profile
+	}
+	return resolved, nil
+}
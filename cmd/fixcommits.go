@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const backupRefPrefix = "refs/gitprofile/backup/"
+
+// rewriteBase returns the base revision of the commits to rewrite. The range
+// must end at HEAD; without one the upstream of the current branch is used.
+func rewriteBase(revisionRange string) (string, error) {
+	if revisionRange == "" {
+		if _, err := runGitCommand("rev-parse", "--verify", "--quiet", "@{upstream}"); err != nil {
+			return "", fmt.Errorf("the current branch has no upstream, pass a range such as origin/main..HEAD")
+		}
+		return "@{upstream}", nil
+	}
+
+	if strings.Contains(revisionRange, "...") {
+		return "", fmt.Errorf("symmetric ranges are not supported, got '%s'", revisionRange)
+	}
+
+	base, tip, found := strings.Cut(revisionRange, "..")
+	if found && tip != "" && tip != "HEAD" {
+		return "", fmt.Errorf("range must end at HEAD, got '%s'", revisionRange)
+	}
+	return base, nil
+}
+
+// countCommits counts the commits selected by the rev-list arguments.
+func countCommits(args ...string) (int, error) {
+	output, err := runGitCommand(append([]string{"rev-list", "--count"}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(output)))
+}
+
+// createBackupRef points a new backup ref at HEAD and returns its name. An
+// existing backup is never overwritten, as refs/gitprofile/ has no reflog:
+// when a run in the same second already created the ref, a counter is added.
+func createBackupRef() (string, error) {
+	branch := "HEAD"
+	if output, err := runGitCommand("symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		branch = strings.TrimSpace(string(output))
+	}
+
+	base := fmt.Sprintf("%s%s/%d", backupRefPrefix, branch, time.Now().Unix())
+	for i := 1; ; i++ {
+		ref := base
+		if i > 1 {
+			ref = fmt.Sprintf("%s-%d", base, i)
+		}
+
+		// An empty old value makes update-ref fail if the ref exists
+		_, err := runGitCommand("update-ref", ref, "HEAD", "")
+		if err == nil {
+			return ref, nil
+		}
+		if _, verifyErr := runGitCommand("rev-parse", "--verify", "--quiet", ref); verifyErr != nil {
+			return "", err
+		}
+	}
+}
+
+// profileConfigArgs returns "-c key=value" options that make a git command
+// run with the profile's identity and signing settings.
+func profileConfigArgs(profile Profile) []string {
+	var args []string
+	for _, entry := range profile.gitConfigEntries() {
+		args = append(args, "-c", entry.Key+"="+entry.Value)
+	}
+	return args
+}
+
+func NewFixCommitsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fix-commits [profile-name] [range]",
+		Short: "Rewrite the identity of unpushed commits",
+		Long: `Rewrite author and committer of local commits with the identity of a profile,
+re-signing them when the profile signs commits. The range defaults to the
+commits not yet on the upstream of the current branch (@{upstream}..HEAD) and
+must end at HEAD. Commits that are reachable from any remote-tracking branch
+are never rewritten. A backup ref under refs/gitprofile/backup/ is created
+before rewriting.`,
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := runGitCommand("rev-parse", "--git-dir"); err != nil {
+				return fmt.Errorf("not a git repository (or any of the parent directories)")
+			}
+
+			profileName := args[0]
+			profiles, err := LoadProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to load profiles: %w", err)
+			}
+
+			profile, exists := profiles[profileName]
+			if !exists {
+				return fmt.Errorf("profile '%s' not found", profileName)
+			}
+			if err := profile.checkSigning(); err != nil {
+				return fmt.Errorf("invalid signing configuration of profile '%s': %w", profileName, err)
+			}
+
+			revisionRange := ""
+			if len(args) == 2 {
+				revisionRange = args[1]
+			}
+			base, err := rewriteBase(revisionRange)
+			if err != nil {
+				return err
+			}
+
+			total, err := countCommits(base + "..HEAD")
+			if err != nil {
+				return fmt.Errorf("invalid range: %w", err)
+			}
+			if total == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No commits to rewrite")
+				return nil
+			}
+
+			unpushed, err := countCommits(base+"..HEAD", "--not", "--remotes")
+			if err != nil {
+				return fmt.Errorf("failed to check for pushed commits: %w", err)
+			}
+			if unpushed != total {
+				return fmt.Errorf("%d of %d commit(s) in the range are already pushed, refusing to rewrite them", total-unpushed, total)
+			}
+
+			status, err := runGitCommand("status", "--porcelain", "--untracked-files=no")
+			if err != nil {
+				return fmt.Errorf("failed to read working tree status: %w", err)
+			}
+			if strings.TrimSpace(string(status)) != "" {
+				return fmt.Errorf("working tree has uncommitted changes, commit or stash them first")
+			}
+
+			backupRef, err := createBackupRef()
+			if err != nil {
+				return fmt.Errorf("failed to create backup ref: %w", err)
+			}
+
+			// Amending with an explicit author keeps the original author date
+			author := fmt.Sprintf("%s <%s>", profile.Name, profile.Email)
+			amend := "git commit --amend --no-edit --allow-empty --author=" + shellQuote(author)
+
+			rebaseArgs := append(profileConfigArgs(profile), "rebase", "--rebase-merges", "--exec", amend, base)
+			if _, err := runGitCommand(rebaseArgs...); err != nil {
+				runGitCommand("rebase", "--abort")
+				return fmt.Errorf("failed to rewrite commits, nothing was changed (backup at %s): %w", backupRef, err)
+			}
+
+			w := cmd.OutOrStdout()
+			fmt.Fprintf(w, "Rewrote %d commit(s) with profile '%s'\n", total, profileName)
+			fmt.Fprintf(w, "Backup of the previous history: %s\n", backupRef)
+			fmt.Fprintf(w, "Undo with: git reset --hard %s\n", backupRef)
+			return nil
+		},
+		ValidArgsFunction: ValidProfileArgsForUse,
+	}
+
+	return cmd
+}
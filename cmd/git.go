@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os/exec"
 	"runtime"
@@ -8,16 +9,124 @@ import (
 )
 
 func runGitCommand(args ...string) ([]byte, error) {
+	return runGitCommandIn("", args...)
+}
+
+// runGitCommandIn runs git in dir instead of the current directory.
+func runGitCommandIn(dir string, args ...string) ([]byte, error) {
 	var cmd *exec.Cmd
 	if runtime.GOOS == "windows" {
 		cmd = exec.Command("git.exe", args...)
 	} else {
 		cmd = exec.Command("git", args...)
 	}
+	cmd.Dir = dir
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return nil, fmt.Errorf("%s: %s", err.Error(), strings.TrimSpace(string(output)))
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
 	}
 	return output, nil
 }
+
+// gitExitCode returns the exit status of a failed git invocation, or -1 if
+// err did not come from git exiting with a status.
+func gitExitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// gitVersionAtLeast reports whether the installed git is at least major.minor.
+func gitVersionAtLeast(major, minor int) (bool, error) {
+	output, err := runGitCommand("version")
+	if err != nil {
+		return false, err
+	}
+
+	// Output looks like "git version 2.39.5" or "git version 2.45.1.windows.1"
+	fields := strings.Fields(string(output))
+	if len(fields) < 3 {
+		return false, fmt.Errorf("unexpected git version output: %s", strings.TrimSpace(string(output)))
+	}
+
+	var gotMajor, gotMinor int
+	if _, err := fmt.Sscanf(fields[2], "%d.%d", &gotMajor, &gotMinor); err != nil {
+		return false, fmt.Errorf("unexpected git version output: %s", strings.TrimSpace(string(output)))
+	}
+
+	if gotMajor != major {
+		return gotMajor > major, nil
+	}
+	return gotMinor >= minor, nil
+}
+
+// configArgs builds the arguments of a git config invocation. An empty
+// scope reads the effective config of all scopes.
+func configArgs(scope string, args ...string) []string {
+	if scope == "" {
+		return append([]string{"config"}, args...)
+	}
+	return append([]string{"config", scope}, args...)
+}
+
+// getConfigRegexp returns all config entries whose key matches pattern.
+// scope selects the config file (e.g. "--local" or "--global"); no matches
+// is not an error.
+func getConfigRegexp(scope, pattern string) ([]configEntry, error) {
+	return getConfigRegexpIn("", scope, pattern)
+}
+
+// getConfigRegexpIn is getConfigRegexp for the repository in dir.
+func getConfigRegexpIn(dir, scope, pattern string) ([]configEntry, error) {
+	output, err := runGitCommandIn(dir, configArgs(scope, "--null", "--get-regexp", pattern)...)
+	if err != nil {
+		if gitExitCode(err) == 1 {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []configEntry
+	for _, record := range strings.Split(string(output), "\x00") {
+		if record == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(record, "\n")
+		entries = append(entries, configEntry{Key: key, Value: value})
+	}
+	return entries, nil
+}
+
+// getConfigValue returns the value of key in the given scope and whether it
+// is set. An empty scope returns the effective value.
+func getConfigValue(scope, key string) (string, bool, error) {
+	return getConfigValueIn("", scope, key)
+}
+
+// getConfigValueIn is getConfigValue for the repository in dir.
+func getConfigValueIn(dir, scope, key string) (string, bool, error) {
+	output, err := runGitCommandIn(dir, configArgs(scope, "--get", key)...)
+	if err != nil {
+		if gitExitCode(err) == 1 {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return strings.TrimSuffix(string(output), "\n"), true, nil
+}
+
+// getConfigBool returns the effective value of a boolean config key, false if
+// it is not set.
+func getConfigBool(key string) (bool, error) {
+	output, err := runGitCommand("config", "--bool", "--get", key)
+	if err != nil {
+		if gitExitCode(err) == 1 {
+			return false, nil
+		}
+		return false, err
+	}
+	return strings.TrimSpace(string(output)) == "true", nil
+}
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	hookName       = "pre-commit"
+	hookMarker     = "# gitprofile identity guard"
+	chainedHookExt = ".gitprofile-chained"
+)
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:@,+%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// getHooksDir returns the directory git runs hooks from, honouring
+// core.hooksPath.
+func getHooksDir() (string, error) {
+	hooksPath, exists, err := getConfigValue("", "core.hooksPath")
+	if err != nil {
+		return "", err
+	}
+
+	if exists && hooksPath != "" {
+		if strings.HasPrefix(hooksPath, "~") {
+			return expandPath(hooksPath)
+		}
+		if filepath.IsAbs(hooksPath) {
+			return hooksPath, nil
+		}
+
+		// Relative hook paths are relative to the top of the worktree
+		output, err := runGitCommand("rev-parse", "--show-toplevel")
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(strings.TrimSpace(string(output)), hooksPath), nil
+	}
+
+	output, err := runGitCommand("rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(strings.TrimSpace(string(output)))
+}
+
+// hookScript returns the pre-commit hook that calls back into gitprofile and
+// then runs the hook it replaced, if any.
+func hookScript(executable string) string {
+	return fmt.Sprintf(`#!/bin/sh
+%s
+# Installed by 'gitprofile hook install', remove with 'gitprofile hook uninstall'.
+%s hook check || exit 1
+
+chained="$(dirname "$0")/%s%s"
+if [ -x "$chained" ]; then
+	exec "$chained" "$@"
+fi
+`, hookMarker, shellQuote(executable), hookName, chainedHookExt)
+}
+
+func isGitprofileHook(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return strings.Contains(string(data), hookMarker), nil
+}
+
+// checkRepositoryIdentity verifies that the effective identity of the
+// current repository belongs to the profile recorded by use in the worktree,
+// local or global config, or else to the profile bound to its directory. A
+// recorded profile that does not exist anymore only produces a warning on w,
+// as it was most likely renamed.
+func checkRepositoryIdentity(w io.Writer) error {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return fmt.Errorf("failed to load profiles: %w", err)
+	}
+
+	expected, _, err := recordedProfile("")
+	if err != nil {
+		return fmt.Errorf("failed to read active profile: %w", err)
+	}
+	stale := false
+	if hint := staleProfileHint(profiles, ""); hint != "" {
+		fmt.Fprintf(w, "gitprofile: warning: %s\n", hint)
+		expected, stale = "", true
+	}
+	if expected == "" {
+		if expected, err = boundProfile(""); err != nil {
+			return fmt.Errorf("failed to read bindings: %w", err)
+		}
+	}
+	if expected == "" && !stale {
+		return fmt.Errorf("no profile is active in this repository, run 'gitprofile use <profile>' first")
+	}
+
+	name, _, err := getConfigValue("", "user.name")
+	if err != nil {
+		return fmt.Errorf("failed to read user.name: %w", err)
+	}
+	email, _, err := getConfigValue("", "user.email")
+	if err != nil {
+		return fmt.Errorf("failed to read user.email: %w", err)
+	}
+
+	_, profileName := matchProfile(profiles, "", name, email)
+	if expected == "" {
+		// Nothing to compare with but the renamed profile, any profile will do
+		if profileName != "" {
+			return nil
+		}
+		return fmt.Errorf("the repository identity %s <%s> does not match any profile", name, email)
+	}
+
+	if profile, exists := profiles[expected]; exists && name == profile.Name && email == profile.Email {
+		return nil
+	}
+	if profileName != "" {
+		return fmt.Errorf("the repository identity belongs to profile '%s', expected profile '%s'", profileName, expected)
+	}
+	return fmt.Errorf("the repository identity %s <%s> does not match any profile, expected profile '%s'", name, email, expected)
+}
+
+func newHookInstallCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "install",
+		Short: "Install the pre-commit identity guard",
+		Long: `Install a pre-commit hook that refuses commits when the repository identity
+does not match the profile activated with 'use' in the worktree, repository or
+global config, or else the profile bound to its directory. An existing pre-commit hook
+is kept and run after the check. core.hooksPath is honoured.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := runGitCommand("rev-parse", "--git-dir"); err != nil {
+				return fmt.Errorf("not a git repository (or any of the parent directories)")
+			}
+
+			dir, err := getHooksDir()
+			if err != nil {
+				return fmt.Errorf("failed to locate hooks directory: %w", err)
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create hooks directory: %w", err)
+			}
+
+			hookPath := filepath.Join(dir, hookName)
+			chainedPath := hookPath + chainedHookExt
+
+			ours, err := isGitprofileHook(hookPath)
+			if err != nil {
+				return fmt.Errorf("failed to read existing hook: %w", err)
+			}
+
+			if !ours {
+				if _, err := os.Stat(hookPath); err == nil {
+					if _, err := os.Stat(chainedPath); err == nil {
+						return fmt.Errorf("cannot keep existing hook, %s already exists", chainedPath)
+					}
+					if err := os.Rename(hookPath, chainedPath); err != nil {
+						return fmt.Errorf("failed to move existing hook: %w", err)
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "Existing hook moved to %s and chained\n", chainedPath)
+				}
+			}
+
+			executable, err := os.Executable()
+			if err != nil {
+				executable = "gitprofile"
+			}
+
+			if err := os.WriteFile(hookPath, []byte(hookScript(executable)), 0755); err != nil {
+				return fmt.Errorf("failed to write hook: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Installed %s hook in %s\n", hookName, dir)
+			return nil
+		},
+	}
+}
+
+func newHookUninstallCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove the pre-commit identity guard",
+		Long:  `Remove the hook installed by 'gitprofile hook install' and restore the hook it replaced`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := runGitCommand("rev-parse", "--git-dir"); err != nil {
+				return fmt.Errorf("not a git repository (or any of the parent directories)")
+			}
+
+			dir, err := getHooksDir()
+			if err != nil {
+				return fmt.Errorf("failed to locate hooks directory: %w", err)
+			}
+
+			hookPath := filepath.Join(dir, hookName)
+			chainedPath := hookPath + chainedHookExt
+
+			ours, err := isGitprofileHook(hookPath)
+			if err != nil {
+				return fmt.Errorf("failed to read existing hook: %w", err)
+			}
+			if !ours {
+				return fmt.Errorf("no gitprofile hook installed in %s", dir)
+			}
+
+			if err := os.Remove(hookPath); err != nil {
+				return fmt.Errorf("failed to remove hook: %w", err)
+			}
+
+			if _, err := os.Stat(chainedPath); err == nil {
+				if err := os.Rename(chainedPath, hookPath); err != nil {
+					return fmt.Errorf("failed to restore previous hook: %w", err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Restored previous %s hook\n", hookName)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Removed %s hook from %s\n", hookName, dir)
+			return nil
+		},
+	}
+}
+
+func newHookCheckCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:           "check",
+		Short:         "Verify the repository identity (run by the pre-commit hook)",
+		Args:          cobra.NoArgs,
+		Hidden:        true,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkRepositoryIdentity(cmd.ErrOrStderr()); err != nil {
+				return fmt.Errorf("gitprofile: %w (use 'git commit --no-verify' to bypass)", err)
+			}
+			return nil
+		},
+	}
+}
+
+func NewHookCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hook",
+		Short: "Manage the pre-commit identity guard",
+		Long:  `Install or remove a pre-commit hook that prevents commits with the wrong identity`,
+	}
+
+	cmd.AddCommand(
+		newHookInstallCmd(),
+		newHookUninstallCmd(),
+		newHookCheckCmd(),
+	)
+
+	return cmd
+}
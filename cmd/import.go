@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// Strategies for imported profiles whose name is already taken.
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+)
+
+// importAction describes what happened to one imported profile.
+type importAction struct {
+	Name   string
+	Target string
+	Action string
+}
+
+// uniqueProfileName returns name with an "-imported" suffix that is not
+// taken yet.
+func uniqueProfileName(profiles ProfileMap, name string) string {
+	candidate := name + "-imported"
+	for i := 2; ; i++ {
+		if _, exists := profiles[candidate]; !exists {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-imported-%d", name, i)
+	}
+}
+
+// mergeImport adds the imported profiles to profiles according to the
+// conflict strategy. Renamed profiles are also renamed where other imported
+// profiles extend them.
+func mergeImport(profiles, imported ProfileMap, strategy string) []importAction {
+	names := make([]string, 0, len(imported))
+	for name := range imported {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var actions []importAction
+	targets := make(map[string]string)
+	for _, name := range names {
+		action := importAction{Name: name, Target: name, Action: "imported"}
+		if _, exists := profiles[name]; exists {
+			switch strategy {
+			case conflictSkip:
+				action.Action = "skipped"
+			case conflictOverwrite:
+				action.Action = "overwritten"
+			case conflictRename:
+				action.Target = uniqueProfileName(profiles, name)
+				// Reserve the name for the following profiles
+				profiles[action.Target] = Profile{}
+			}
+		}
+		if action.Action != "skipped" {
+			targets[name] = action.Target
+		}
+		actions = append(actions, action)
+	}
+
+	for name, target := range targets {
+		profile := imported[name]
+		if renamed, ok := targets[profile.Extends]; ok {
+			profile.Extends = renamed
+		}
+		profile.Origin = ""
+		profiles[target] = profile
+	}
+
+	return actions
+}
+
+// validateProfile checks a profile the way add does, with its inheritance
+// resolved. Key files are not checked as they may not exist on this machine
+// yet.
+func validateProfile(profiles ProfileMap, name string) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+	resolved, _, err := resolveProfile(profiles, name)
+	if err != nil {
+		return err
+	}
+	if resolved.Name == "" || resolved.Email == "" {
+		return fmt.Errorf("name and email are required, neither set nor inherited")
+	}
+	if err := resolved.validateSigning(); err != nil {
+		return err
+	}
+	if err := resolved.checkSSH(); err != nil {
+		return err
+	}
+	for _, entry := range resolved.sortedGitConfig() {
+		if _, _, err := parseConfigAssignment(entry.Key + "=" + entry.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewImportCmd() *cobra.Command {
+	var format, conflict string
+	var fromGit, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "import [file | --from-git [dir]]",
+		Short: "Import profiles from a file or git config",
+		Long: `Add the profiles of a file written by 'gitprofile export', or of another
+profiles file, to your profiles. The format is taken from the file extension
+unless --format is given; use - to read from stdin. Profiles whose name is
+taken are skipped, overwritten or imported under a new name depending on
+--conflict. All imported profiles are validated before anything is saved.
+
+With --from-git the identities (name, email, signing key and ssh command) of
+the global git config and the files it includes are collected, and with a
+directory also those of all repositories below it. A profile is proposed for
+every identity that is not a profile yet, asking for its name unless --yes is
+given.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if fromGit {
+				dir := ""
+				if len(args) > 0 {
+					dir = args[0]
+				}
+				return importFromGit(cmd, dir, yes)
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("a file to import is required, or --from-git")
+			}
+
+			switch conflict {
+			case conflictSkip, conflictOverwrite, conflictRename:
+			default:
+				return fmt.Errorf("invalid conflict strategy '%s' (must be skip, overwrite or rename)", conflict)
+			}
+
+			path := args[0]
+			if format == "" {
+				format = formatFromPath(path)
+			}
+			if err := validateProfileFormat(format); err != nil {
+				return err
+			}
+
+			var data []byte
+			var err error
+			if path == "-" {
+				data, err = io.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = os.ReadFile(path)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", path, err)
+			}
+
+			imported, err := decodeProfiles(data, format)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+			if len(imported) == 0 {
+				return fmt.Errorf("no profiles found in %s", path)
+			}
+
+			var actions []importAction
+			err = UpdateProfiles(func(profiles ProfileMap) error {
+				actions = mergeImport(profiles, imported, conflict)
+
+				var errs []error
+				for _, action := range actions {
+					if action.Action == "skipped" {
+						continue
+					}
+					if err := validateProfile(profiles, action.Target); err != nil {
+						errs = append(errs, fmt.Errorf("profile '%s': %w", action.Name, err))
+					}
+				}
+				if len(errs) > 0 {
+					return fmt.Errorf("nothing imported, invalid profiles:\n%w", errors.Join(errs...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			w := cmd.OutOrStdout()
+			for _, action := range actions {
+				switch {
+				case action.Action == "skipped":
+					fmt.Fprintf(w, "Skipped '%s', a profile with this name exists\n", action.Name)
+				case action.Target != action.Name:
+					fmt.Fprintf(w, "Imported '%s' as '%s'\n", action.Name, action.Target)
+				default:
+					fmt.Fprintf(w, "Profile '%s' %s\n", action.Name, action.Action)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "", "Input format (json, yaml or toml), default from the file extension")
+	cmd.Flags().BoolVar(&fromGit, "from-git", false, "Create profiles from the identities in git config")
+	cmd.Flags().BoolVar(&yes, "yes", false, "With --from-git, add all proposed profiles without asking")
+	cmd.Flags().StringVar(&conflict, "conflict", conflictSkip, "What to do with profiles whose name is taken (skip, overwrite or rename)")
+	cmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return profileFormats, cobra.ShellCompDirectiveNoFileComp
+	})
+	cmd.RegisterFlagCompletionFunc("conflict", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{conflictSkip, conflictOverwrite, conflictRename}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return cmd
+}
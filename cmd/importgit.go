@@ -0,0 +1,461 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// gitIdentity is a combination of identity settings found in git config.
+type gitIdentity struct {
+	Name          string
+	Email         string
+	SigningKey    string
+	SSHCommand    string
+	SigningFormat string
+	SignCommits   bool
+
+	// Sources are the config files and repositories it was found in
+	Sources []string
+}
+
+// key identifies an identity when deduplicating. Signing options other than
+// the key are taken from the first occurrence.
+func (id gitIdentity) key() string {
+	return strings.Join([]string{id.Name, id.Email, id.SigningKey, id.SSHCommand}, "\x00")
+}
+
+func (id gitIdentity) String() string {
+	return fmt.Sprintf("%s <%s>", id.Name, id.Email)
+}
+
+// readGitConfigFile returns the entries of a single config file in file
+// order.
+func readGitConfigFile(path string) ([]configEntry, error) {
+	output, err := runGitCommand("config", "--file", path, "--null", "--list")
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigList(output), nil
+}
+
+// parseConfigList parses the output of git config --null --list. Every value
+// of a multi-valued key such as include.path is kept, in the order git lists
+// them.
+func parseConfigList(output []byte) []configEntry {
+	var config []configEntry
+	for _, record := range strings.Split(string(output), "\x00") {
+		if record == "" {
+			continue
+		}
+		key, value, found := strings.Cut(record, "\n")
+		if !found {
+			// A key without value is a boolean true
+			value = "true"
+		}
+		config = append(config, configEntry{Key: key, Value: value})
+	}
+	return config
+}
+
+func parseGitBool(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+	return false
+}
+
+// overlay returns the identity with the identity keys set in config
+// replacing its values. The last value of a key wins, as in git.
+func (id gitIdentity) overlay(config []configEntry) gitIdentity {
+	for _, entry := range config {
+		switch entry.Key {
+		case "user.name":
+			id.Name = entry.Value
+		case "user.email":
+			id.Email = entry.Value
+		case "user.signingkey":
+			id.SigningKey = entry.Value
+		case "core.sshcommand":
+			id.SSHCommand = entry.Value
+		case "gpg.format":
+			id.SigningFormat = entry.Value
+		case "commit.gpgsign":
+			id.SignCommits = parseGitBool(entry.Value)
+		}
+	}
+	id.Sources = nil
+	return id
+}
+
+// globalGitConfigFiles returns the existing global config files in the order
+// git reads them.
+func globalGitConfigFiles() ([]string, error) {
+	var candidates []string
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		candidates = []string{path}
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if xdg == "" {
+			xdg = filepath.Join(home, ".config")
+		}
+		candidates = []string{filepath.Join(xdg, "git", "config"), filepath.Join(home, ".gitconfig")}
+	}
+
+	var files []string
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// configIncludes returns the files included by a config file, conditionally
+// or not, in file order and resolved the way git does.
+func configIncludes(path string, config []configEntry) []string {
+	var includes []string
+	for _, entry := range config {
+		key := entry.Key
+		if key != "include.path" && !(strings.HasPrefix(key, "includeif.") && strings.HasSuffix(key, ".path")) {
+			continue
+		}
+		include := entry.Value
+		if strings.HasPrefix(include, "~") {
+			expanded, err := expandPath(include)
+			if err != nil {
+				continue
+			}
+			include = expanded
+		} else if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		includes = append(includes, include)
+	}
+	return includes
+}
+
+// collectGitIdentities returns the distinct identities of the global git
+// config, the files it includes and, if dir is not empty, the repositories
+// below dir. Identities without name or email are left out.
+func collectGitIdentities(dir string) ([]gitIdentity, error) {
+	var identities []gitIdentity
+	index := make(map[string]int)
+	add := func(id gitIdentity, source string) {
+		if id.Name == "" || id.Email == "" {
+			return
+		}
+		if i, ok := index[id.key()]; ok {
+			identities[i].Sources = append(identities[i].Sources, source)
+			return
+		}
+		id.Sources = []string{source}
+		index[id.key()] = len(identities)
+		identities = append(identities, id)
+	}
+
+	files, err := globalGitConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var global gitIdentity
+	var pending []string
+	for _, file := range files {
+		config, err := readGitConfigFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		global = global.overlay(config)
+		pending = append(pending, configIncludes(file, config)...)
+	}
+	if len(files) > 0 {
+		add(global, strings.Join(files, ", "))
+	}
+
+	// Included files override the global identity where they apply
+	seen := make(map[string]bool)
+	for len(pending) > 0 {
+		file := pending[0]
+		pending = pending[1:]
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+
+		config, err := readGitConfigFile(file)
+		if err != nil {
+			// Includes of missing files are ignored by git as well
+			continue
+		}
+		add(global.overlay(config), file)
+		pending = append(pending, configIncludes(file, config)...)
+	}
+
+	if dir == "" {
+		return identities, nil
+	}
+
+	repos, err := findRepositories(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		output, err := runGitCommandIn(repo, "config", "--null", "--list")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config of %s: %w", repo, err)
+		}
+		add(gitIdentity{}.overlay(parseConfigList(output)), repo)
+	}
+
+	return identities, nil
+}
+
+// parseSSHCommand sets the ssh fields of a profile from a core.sshCommand.
+// Commands using arguments a profile cannot express are rejected.
+func parseSSHCommand(command string, p *Profile) error {
+	args, err := splitShellWords(command)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	if filepath.Base(args[0]) != defaultSSHProgram {
+		p.SSHProgram = args[0]
+	}
+	for i := 1; i < len(args); i++ {
+		arg, original := args[i], args[i]
+		value := ""
+		if len(arg) > 2 && strings.HasPrefix(arg, "-") {
+			arg, value = arg[:2], arg[2:]
+		} else if i+1 < len(args) {
+			value = args[i+1]
+			i++
+		}
+
+		switch {
+		case arg == "-i" && p.SSHKey == "":
+			p.SSHKey = value
+		case arg == "-p":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid port '%s'", value)
+			}
+			p.SSHPort = port
+		case arg == "-o" && strings.EqualFold(value, "IdentitiesOnly=yes"):
+			p.SSHIdentitiesOnly = boolPtr(true)
+		case arg == "-o":
+			p.SSHOptions = append(p.SSHOptions, value)
+		default:
+			return fmt.Errorf("unsupported argument '%s'", original)
+		}
+	}
+
+	_, err = p.sshCommandArgs()
+	return err
+}
+
+// profile returns the profile for the identity. A core.sshCommand the
+// profile cannot express is returned as error, the profile is usable
+// without it.
+func (id gitIdentity) profile() (Profile, error) {
+	p := Profile{
+		Name:          id.Name,
+		Email:         id.Email,
+		GPGKey:        id.SigningKey,
+		SigningFormat: id.SigningFormat,
+	}
+	if id.SignCommits {
+		p.SignCommits = boolPtr(true)
+	}
+	if id.SSHCommand == "" {
+		return p, nil
+	}
+
+	withSSH := p
+	if err := parseSSHCommand(id.SSHCommand, &withSSH); err != nil {
+		return p, fmt.Errorf("cannot convert core.sshCommand '%s': %w", id.SSHCommand, err)
+	}
+	return withSSH, nil
+}
+
+// matchingProfile returns the name of a profile with the same identity.
+func matchingProfile(profiles ProfileMap, p Profile) string {
+	wanted, _ := p.sshCommandArgs()
+	for name, existing := range profiles {
+		if existing.Name != p.Name || existing.Email != p.Email || existing.GPGKey != p.GPGKey {
+			continue
+		}
+		args, _ := existing.sshCommandArgs()
+		if strings.Join(args, "\x00") == strings.Join(wanted, "\x00") {
+			return name
+		}
+	}
+	return ""
+}
+
+var profileNameCleaner = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// proposeProfileName derives a profile name from the domain of an email
+// address, e.g. company for john@mail.company.com.
+func proposeProfileName(email string, taken func(string) bool) string {
+	_, domain, _ := strings.Cut(strings.ToLower(email), "@")
+	labels := strings.Split(domain, ".")
+	base := labels[0]
+	if len(labels) >= 2 {
+		base = labels[len(labels)-2]
+	}
+	base = strings.Trim(profileNameCleaner.ReplaceAllString(base, "-"), "-")
+	if base == "" {
+		base = "profile"
+	}
+
+	name := base
+	for i := 2; taken(name); i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	return name
+}
+
+// importFromGit proposes a profile for every identity found in git config
+// and saves the accepted ones.
+func importFromGit(cmd *cobra.Command, dir string, yes bool) error {
+	if dir != "" {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		dir = absDir
+	}
+
+	identities, err := collectGitIdentities(dir)
+	if err != nil {
+		return err
+	}
+
+	raw, err := LoadRawProfiles()
+	if err != nil {
+		return fmt.Errorf("failed to load profiles: %w", err)
+	}
+	resolved, err := resolveProfiles(raw)
+	if err != nil {
+		return err
+	}
+
+	w := cmd.OutOrStdout()
+	input := bufio.NewReader(cmd.InOrStdin())
+	taken := func(name string) bool {
+		_, exists := raw[name]
+		return exists
+	}
+
+	var added []string
+	for _, id := range identities {
+		profile, convertErr := id.profile()
+		if existing := matchingProfile(resolved, profile); existing != "" {
+			fmt.Fprintf(w, "%s is already profile '%s'\n", id, existing)
+			continue
+		}
+
+		fmt.Fprintf(w, "\n%s\n", id)
+		if id.SigningKey != "" {
+			fmt.Fprintf(w, "  Signing key: %s\n", id.SigningKey)
+		}
+		if id.SSHCommand != "" {
+			fmt.Fprintf(w, "  SSH command: %s\n", id.SSHCommand)
+		}
+		if convertErr != nil {
+			fmt.Fprintf(w, "  Warning: %v, left out\n", convertErr)
+		}
+		fmt.Fprintf(w, "  Found in: %s\n", strings.Join(id.Sources, ", "))
+
+		name := proposeProfileName(id.Email, taken)
+		if !yes {
+			name, err = promptProfileName(w, input, name, taken)
+			if err != nil {
+				return err
+			}
+			if name == "" {
+				continue
+			}
+		}
+
+		raw[name] = profile
+		added = append(added, name)
+	}
+
+	if len(added) == 0 {
+		fmt.Fprintln(w, "No profiles added")
+		return nil
+	}
+
+	// The answers are complete, merge them under the lock so profiles saved
+	// by another invocation in the meantime are kept
+	err = UpdateProfiles(func(profiles ProfileMap) error {
+		for _, name := range added {
+			if _, exists := profiles[name]; exists {
+				return fmt.Errorf("profile '%s' was added in the meantime, nothing imported", name)
+			}
+			profiles[name] = raw[name]
+			if err := validateProfile(profiles, name); err != nil {
+				return fmt.Errorf("profile '%s': %w", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	for _, name := range added {
+		fmt.Fprintf(w, "Profile '%s' added (%s <%s>)\n", name, raw[name].Name, raw[name].Email)
+	}
+	return nil
+}
+
+// promptProfileName asks for the name of a new profile until it gets a valid
+// one that is not taken. An empty answer accepts the proposal, "-" or the end
+// of the input skips the identity and an empty name is returned.
+func promptProfileName(w io.Writer, input *bufio.Reader, proposal string, taken func(string) bool) (string, error) {
+	for {
+		fmt.Fprintf(w, "  Profile name [%s] (- to skip): ", proposal)
+		line, err := input.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		answer := strings.TrimSpace(line)
+
+		switch {
+		case answer == "" && err == io.EOF:
+			fmt.Fprintln(w)
+			return "", nil
+		case answer == "":
+			return proposal, nil
+		case answer == "-":
+			return "", nil
+		case taken(answer):
+			fmt.Fprintf(w, "  Profile '%s' exists, choose another name\n", answer)
+		default:
+			if err := validateProfileName(answer); err != nil {
+				fmt.Fprintf(w, "  %v, choose another name\n", err)
+				continue
+			}
+			return answer, nil
+		}
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -13,6 +14,10 @@ func NewListCmd() *cobra.Command {
 		Long:  `Display all saved git profiles with their settings`,
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			configPath, err := GetConfigPath()
+			if err != nil {
+				return err
+			}
 			profiles, err := LoadProfiles()
 			if err != nil {
 				return fmt.Errorf("failed to load profiles: %w", err)
@@ -22,6 +27,14 @@ func NewListCmd() *cobra.Command {
 
 			for name, profile := range profiles {
 				fmt.Fprintf(w, "\nProfile: %s\n", name)
+				if profile.readOnly() {
+					fmt.Fprintf(w, "  Origin: %s (read-only)\n", profile.Origin)
+				} else {
+					fmt.Fprintf(w, "  Origin: %s\n", configPath)
+				}
+				if profile.Extends != "" {
+					fmt.Fprintf(w, "  Extends: %s\n", profile.Extends)
+				}
 				fmt.Fprintf(w, "  Name: %s\n", profile.Name)
 				fmt.Fprintf(w, "  Email: %s\n", profile.Email)
 				if profile.GPGKey != "" {
@@ -30,7 +43,26 @@ func NewListCmd() *cobra.Command {
 				if profile.SSHKey != "" {
 					fmt.Fprintf(w, "  SSH Key: %s\n", profile.SSHKey)
 				}
-				fmt.Fprintf(w, "  Sign Commits: %v\n", profile.SignCommits)
+				if profile.hasSSHOptions() {
+					if command, err := profile.sshCommand(); err == nil {
+						fmt.Fprintf(w, "  SSH Command: %s\n", command)
+					} else {
+						fmt.Fprintf(w, "  SSH Command: invalid (%v)\n", err)
+					}
+				}
+				fmt.Fprintf(w, "  Sign Commits: %v\n", profile.signsCommits())
+				if profile.SigningFormat != "" {
+					fmt.Fprintf(w, "  Signing Format: %s\n", profile.SigningFormat)
+				}
+				if len(profile.Remotes) > 0 {
+					fmt.Fprintf(w, "  Remotes: %s\n", strings.Join(profile.Remotes, ", "))
+				}
+				if len(profile.GitConfig) > 0 {
+					fmt.Fprintln(w, "  Git Config:")
+					for _, entry := range profile.sortedGitConfig() {
+						fmt.Fprintf(w, "    %s = %s\n", entry.Key, entry.Value)
+					}
+				}
 			}
 
 			return nil
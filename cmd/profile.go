@@ -1,108 +1,746 @@
 package cmd
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
 )
 
 type Profile struct {
-	Name        string `json:"name"`
-	Email       string `json:"email"`
-	GPGKey      string `json:"gpg_key,omitempty"`
-	SignCommits bool   `json:"sign_commits"`
-	SSHKey      string `json:"ssh_key,omitempty"`
+	// Extends names a profile this one inherits the fields it leaves unset
+	// from, see resolveProfile.
+	Extends string `json:"extends,omitempty"`
+
+	Name        string   `json:"name"`
+	Email       string   `json:"email"`
+	GPGKey      string   `json:"gpg_key,omitempty"`
+	SignCommits *bool    `json:"sign_commits,omitempty"`
+	SSHKey      string   `json:"ssh_key,omitempty"`
+	Remotes     []string `json:"remotes,omitempty"`
+
+	// SigningFormat selects how commits are signed: openpgp (default), ssh
+	// or x509. For ssh, GPGKey holds the path to the signing key.
+	SigningFormat      string `json:"signing_format,omitempty"`
+	AllowedSignersFile string `json:"allowed_signers_file,omitempty"`
+	X509Program        string `json:"x509_program,omitempty"`
+
+	// SSH options used together with SSHKey to build core.sshCommand.
+	// SSHOptions are passed to ssh as -o Keyword=value.
+	SSHProgram        string   `json:"ssh_program,omitempty"`
+	SSHPort           int      `json:"ssh_port,omitempty"`
+	SSHIdentitiesOnly *bool    `json:"ssh_identities_only,omitempty"`
+	SSHOptions        []string `json:"ssh_options,omitempty"`
+
+	// GitConfig holds additional git config keys (e.g. pull.rebase) that are
+	// applied together with the profile.
+	GitConfig map[string]string `json:"git_config,omitempty"`
+
+	// Origin is the registry file a read-only profile was loaded from, empty
+	// for profiles stored in the user's profiles file.
+	Origin string `json:"-"`
 }
 
 type ProfileMap map[string]Profile
 
+// profileNamePattern restricts profile names to characters that are safe in
+// include file names, ssh Host aliases and git config values.
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// validateProfileName checks the name of a new profile.
+func validateProfileName(name string) error {
+	if name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name '%s' (use letters, digits, '.', '_' and '-', starting with a letter or digit)", name)
+	}
+	return nil
+}
+
+// boolPtr returns a pointer to b. The booleans of a profile are pointers so
+// that an explicit false can be told apart from an unset, inherited value.
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// signsCommits reports whether the profile signs commits and tags.
+func (p Profile) signsCommits() bool {
+	return p.SignCommits != nil && *p.SignCommits
+}
+
+// identitiesOnly reports whether ssh only offers the profile's key.
+func (p Profile) identitiesOnly() bool {
+	return p.SSHIdentitiesOnly != nil && *p.SSHIdentitiesOnly
+}
+
+// Supported values of Profile.SigningFormat
+const (
+	SigningFormatOpenPGP = "openpgp"
+	SigningFormatSSH     = "ssh"
+	SigningFormatX509    = "x509"
+)
+
+// defaultX509Program is used for gpg.x509.program when a profile signs with
+// X.509 but does not name a program.
+const defaultX509Program = "gpgsm"
+
+// configEntry is a single git config key and the value a profile assigns to it.
+type configEntry struct {
+	Key   string
+	Value string
+}
+
+// gitConfigEntries returns the git config keys a profile sets, in the order
+// they are applied.
+func (p Profile) gitConfigEntries() []configEntry {
+	entries := []configEntry{
+		{Key: "user.name", Value: p.Name},
+		{Key: "user.email", Value: p.Email},
+	}
+
+	if p.GPGKey != "" {
+		signingKey := p.GPGKey
+		if p.SigningFormat == SigningFormatSSH && !strings.HasPrefix(signingKey, "key::") {
+			if expanded, err := expandPath(signingKey); err == nil {
+				signingKey = expanded
+			}
+		}
+		entries = append(entries, configEntry{Key: "user.signingkey", Value: signingKey})
+	}
+
+	if p.SigningFormat != "" {
+		entries = append(entries, configEntry{Key: "gpg.format", Value: p.SigningFormat})
+	}
+	switch p.SigningFormat {
+	case SigningFormatSSH:
+		if p.AllowedSignersFile != "" {
+			entries = append(entries, configEntry{Key: "gpg.ssh.allowedSignersFile", Value: p.AllowedSignersFile})
+		}
+	case SigningFormatX509:
+		program := p.X509Program
+		if program == "" {
+			program = defaultX509Program
+		}
+		entries = append(entries, configEntry{Key: "gpg.x509.program", Value: program})
+	}
+
+	signValue := "false"
+	if p.signsCommits() {
+		signValue = "true"
+	}
+	entries = append(entries,
+		configEntry{Key: "commit.gpgsign", Value: signValue},
+		configEntry{Key: "tag.gpgsign", Value: signValue},
+	)
+
+	// Invalid ssh settings are rejected by checkSSH before anything is written
+	if command, err := p.sshCommand(); err == nil && command != "" {
+		entries = append(entries, configEntry{Key: "core.sshCommand", Value: command})
+	}
+
+	// Extra keys come last and take precedence over the built-in ones
+	for _, extra := range p.sortedGitConfig() {
+		replaced := false
+		for i := range entries {
+			if strings.EqualFold(entries[i].Key, extra.Key) {
+				entries[i].Value = extra.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			entries = append(entries, extra)
+		}
+	}
+
+	return entries
+}
+
+// validateSigningFormat checks that the signing format is one git supports.
+func validateSigningFormat(format string) error {
+	switch format {
+	case "", SigningFormatOpenPGP, SigningFormatSSH, SigningFormatX509:
+		return nil
+	}
+	return fmt.Errorf("invalid signing format '%s' (must be openpgp, ssh or x509)", format)
+}
+
+// validateSigning checks that the signing settings of a profile are complete,
+// without looking at key files.
+func (p Profile) validateSigning() error {
+	if err := validateSigningFormat(p.SigningFormat); err != nil {
+		return err
+	}
+	if p.SigningFormat == SigningFormatSSH && p.GPGKey == "" && p.signsCommits() {
+		return fmt.Errorf("ssh signing requires a signing key")
+	}
+	return nil
+}
+
+// checkSigning validates the signing settings of a profile before they are
+// applied. SSH signing keys given as a path must exist.
+func (p Profile) checkSigning() error {
+	if err := p.validateSigning(); err != nil {
+		return err
+	}
+
+	if p.SigningFormat != SigningFormatSSH || p.GPGKey == "" {
+		return nil
+	}
+
+	// Literal public keys are passed as "key::ssh-ed25519 AAAA..."
+	if strings.HasPrefix(p.GPGKey, "key::") {
+		return nil
+	}
+
+	path, err := expandPath(p.GPGKey)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("ssh signing key %s: %w", p.GPGKey, err)
+	}
+
+	return nil
+}
+
+// parseConfigAssignment splits a "key=value" assignment and validates the
+// key. Keys need at least a section and a name, e.g. pull.rebase or
+// url.git@github.com:.insteadOf.
+func parseConfigAssignment(assignment string) (string, string, error) {
+	key, value, found := strings.Cut(assignment, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" {
+		return "", "", fmt.Errorf("invalid git config assignment '%s' (expected key=value)", assignment)
+	}
+
+	dot := strings.Index(key, ".")
+	lastDot := strings.LastIndex(key, ".")
+	if dot <= 0 || lastDot == len(key)-1 {
+		return "", "", fmt.Errorf("invalid git config key '%s' (expected section.name)", key)
+	}
+
+	return key, value, nil
+}
+
+// sortedGitConfig returns the extra git config entries of a profile sorted
+// by key.
+func (p Profile) sortedGitConfig() []configEntry {
+	entries := make([]configEntry, 0, len(p.GitConfig))
+	for key, value := range p.GitConfig {
+		entries = append(entries, configEntry{Key: key, Value: value})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
 var (
 	configFileName = ".gitprofiles.json"
 	testConfigPath string // Used for testing
+	configFlagPath string // Set by the --config flag
 )
 
+// configEnvVar names the environment variable selecting the profiles file.
+const configEnvVar = "GITPROFILE_CONFIG"
+
 // SetTestConfigPath sets a temporary config path for testing
 func SetTestConfigPath(path string) {
 	testConfigPath = path
 }
 
-func GetConfigPath() (string, error) {
+// AddConfigFlag registers the persistent --config flag on the root command.
+func AddConfigFlag(root *cobra.Command) {
+	root.PersistentFlags().StringVar(&configFlagPath, "config", "", "Profiles file to use (overrides "+configEnvVar+")")
+}
+
+// xdgConfigPath returns the profiles file below $XDG_CONFIG_HOME, which
+// defaults to ~/.config. Relative values are ignored as the spec requires.
+func xdgConfigPath(homeDir string) string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" || !filepath.IsAbs(configHome) {
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configHome, "gitprofile", "profiles.json")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// ResolveConfigPath returns the profiles file in use and the reason it was
+// chosen. The first of these wins:
+//
+//  1. the --config flag
+//  2. the GITPROFILE_CONFIG environment variable
+//  3. $XDG_CONFIG_HOME/gitprofile/profiles.json (or ~/.config/...) if it exists
+//  4. ~/.gitprofiles.json if it exists
+//  5. for a new file, the XDG location if XDG_CONFIG_HOME is set, else
+//     ~/.gitprofiles.json
+//
+// The returned path is always absolute: a relative --config or
+// GITPROFILE_CONFIG is resolved against the current directory, so include
+// files and registries next to it do not move when the directory changes.
+func ResolveConfigPath() (string, string, error) {
 	if testConfigPath != "" {
-		return testConfigPath, nil
+		return testConfigPath, "test override", nil
+	}
+
+	if configFlagPath != "" {
+		path, err := expandPath(configFlagPath)
+		return path, "set by --config", err
+	}
+	if env := os.Getenv(configEnvVar); env != "" {
+		path, err := expandPath(env)
+		return path, "set by " + configEnvVar, err
 	}
 
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+
+	xdgPath := xdgConfigPath(homeDir)
+	legacyPath := filepath.Join(homeDir, configFileName)
+
+	switch {
+	case fileExists(xdgPath):
+		return xdgPath, "XDG config location", nil
+	case fileExists(legacyPath):
+		return legacyPath, "existing file in the home directory", nil
+	case os.Getenv("XDG_CONFIG_HOME") != "":
+		return xdgPath, "XDG_CONFIG_HOME is set, file does not exist yet", nil
 	}
-	return filepath.Join(homeDir, configFileName), nil
+	return legacyPath, "default, file does not exist yet", nil
 }
 
-func LoadProfiles() (ProfileMap, error) {
-	configPath, err := GetConfigPath()
-	if err != nil {
+func GetConfigPath() (string, error) {
+	path, _, err := ResolveConfigPath()
+	return path, err
+}
+
+// ErrProfilesModified is returned by SaveProfiles when another process changed
+// the profiles file after it was loaded.
+var ErrProfilesModified = errors.New("profiles file was modified by another process, reload and try again")
+
+// profileChecksums holds the checksum of the profiles file as this process
+// last read or wrote it, per path.
+var (
+	profileChecksumsMu sync.Mutex
+	profileChecksums   = make(map[string][sha256.Size]byte)
+)
+
+func rememberChecksum(path string, data []byte) {
+	profileChecksumsMu.Lock()
+	defer profileChecksumsMu.Unlock()
+	profileChecksums[path] = sha256.Sum256(data)
+}
+
+// checkUnmodified fails if the profiles file no longer has the content this
+// process loaded. A missing file counts as empty.
+func checkUnmodified(path string) error {
+	profileChecksumsMu.Lock()
+	expected, loaded := profileChecksums[path]
+	profileChecksumsMu.Unlock()
+	if !loaded {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if sha256.Sum256(data) != expected {
+		return ErrProfilesModified
+	}
+	return nil
+}
+
+// lockProfiles takes an exclusive lock on the profiles file and returns the
+// function releasing it. The lock lives in a separate file, as the profiles
+// file itself is replaced on every save.
+func lockProfiles(configPath string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return nil, err
 	}
 
+	f, err := os.OpenFile(configPath+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock profiles: %w", err)
+	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// writeFileAtomic replaces path with data by writing a temporary file next to
+// it and renaming it, so readers never see a partial file. The mode of an
+// existing file is kept and a symlinked file is written through the link.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// readConfig reads and decodes the profiles file. A missing file is an empty
+// document.
+func readConfig(configPath string) (*configDocument, error) {
 	data, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	doc, err := decodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	rememberChecksum(configPath, data)
+	return doc, nil
+}
+
+// readProfiles reads the user's profiles and merges the registry profiles
+// they do not override underneath them.
+func readProfiles(configPath string) (ProfileMap, error) {
+	doc, err := readConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	registries, err := loadRegistries(configPath, doc.Settings)
+	if err != nil {
+		return nil, err
+	}
+	for name, profile := range registries {
+		if _, exists := doc.Profiles[name]; !exists {
+			doc.Profiles[name] = profile
+		}
+	}
+
+	return doc.Profiles, nil
+}
+
+// writeProfiles replaces the profiles in the file and keeps its settings.
+// Registry profiles are never written. The file is always written in the
+// current format.
+func writeProfiles(configPath string, profiles ProfileMap) error {
+	doc, err := readConfig(configPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return make(ProfileMap), nil
+		return err
+	}
+
+	doc.Profiles = make(ProfileMap, len(profiles))
+	for name, profile := range profiles {
+		if !profile.readOnly() {
+			doc.Profiles[name] = profile
 		}
+	}
+
+	data, err := encodeConfig(doc)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(configPath, data, 0644); err != nil {
+		return err
+	}
+
+	rememberChecksum(configPath, data)
+	return nil
+}
+
+// LoadProfiles returns all profiles with their inheritance resolved. It fails
+// if a profile extends an unknown profile or the inheritance has a cycle.
+func LoadProfiles() (ProfileMap, error) {
+	profiles, err := LoadRawProfiles()
+	if err != nil {
 		return nil, err
 	}
 
-	var profiles ProfileMap
-	if err := json.Unmarshal(data, &profiles); err != nil {
+	return resolveProfiles(profiles)
+}
+
+// LoadRawProfiles returns the profiles as stored, without inherited fields.
+// Profiles that are modified and saved must be loaded this way.
+func LoadRawProfiles() (ProfileMap, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
 		return nil, err
 	}
 
-	return profiles, nil
+	return readProfiles(configPath)
 }
 
+// SaveProfiles writes the profiles file. It fails with ErrProfilesModified if
+// another process changed the file since this process loaded it.
 func SaveProfiles(profiles ProfileMap) error {
 	configPath, err := GetConfigPath()
 	if err != nil {
 		return err
 	}
 
-	data, err := json.MarshalIndent(profiles, "", "  ")
+	unlock, err := lockProfiles(configPath)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	return os.WriteFile(configPath, data, 0644)
+	if err := checkUnmodified(configPath); err != nil {
+		return err
+	}
+	if _, err := resolveProfiles(profiles); err != nil {
+		return err
+	}
+
+	return writeProfiles(configPath, profiles)
+}
+
+// UpdateProfiles loads the profiles as stored, lets update modify them and
+// saves the result while holding the lock, so concurrent invocations cannot lose each
+// other's changes. Nothing is saved if update returns an error. Registry
+// profiles are passed to update but only the user's profiles are saved.
+func UpdateProfiles(update func(profiles ProfileMap) error) error {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockProfiles(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	profiles, err := readProfiles(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load profiles: %w", err)
+	}
+
+	if err := update(profiles); err != nil {
+		return err
+	}
+	if _, err := resolveProfiles(profiles); err != nil {
+		return err
+	}
+
+	if err := writeProfiles(configPath, profiles); err != nil {
+		return fmt.Errorf("failed to save profiles: %w", err)
+	}
+	return nil
 }
 
 // GetCurrentProfile returns the currently active profile in the current repository
 func GetCurrentProfile() (*Profile, string, error) {
-	// Get current git user name and email
-	name, err := runGitCommand("config", "--local", "user.name")
+	profile, profileName, _, err := currentProfile("")
+	return profile, profileName, err
+}
+
+// currentProfile returns the profile matching the effective identity of the
+// repository in dir and where the identity comes from: the config scope it is
+// set in, or "binding" if a bind include file provides it. An empty dir is
+// the current directory.
+func currentProfile(dir string) (*Profile, string, string, error) {
+	name, nameSet, err := getConfigValueIn(dir, "", "user.name")
 	if err != nil {
-		return nil, "", nil // No local git config found
+		return nil, "", "", err
 	}
-
-	email, err := runGitCommand("config", "--local", "user.email")
+	email, emailSet, err := getConfigValueIn(dir, "", "user.email")
 	if err != nil {
-		return nil, "", nil
+		return nil, "", "", err
+	}
+	if !nameSet || !emailSet {
+		return nil, "", "", nil
 	}
 
-	// Load all profiles
 	profiles, err := LoadProfiles()
 	if err != nil {
-		return nil, "", err
+		return nil, "", "", err
+	}
+
+	profile, profileName := matchProfile(profiles, dir, name, email)
+	if profile == nil {
+		return nil, "", "", nil
+	}
+
+	source, err := identitySource(dir)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return profile, profileName, source, nil
+}
+
+// Sources of the effective identity reported by identitySource
+const (
+	sourceWorktree = "worktree"
+	sourceLocal    = "local"
+	sourceGlobal   = "global"
+	sourceBinding  = "binding"
+)
+
+// sourceDescription names an identity source in user facing messages.
+func sourceDescription(source string) string {
+	switch source {
+	case sourceWorktree:
+		return "worktree config"
+	case sourceLocal:
+		return "repository config"
+	case sourceGlobal:
+		return "global git config"
+	case sourceBinding:
+		return "directory binding"
+	}
+	return source + " config"
+}
+
+// identitySource returns where the effective user.email of the repository in
+// dir is set: the config scope as reported by git, or sourceBinding if it
+// comes from a gitprofile include file.
+func identitySource(dir string) (string, error) {
+	if profileName, err := boundProfile(dir); err != nil {
+		return "", err
+	} else if profileName != "" {
+		return sourceBinding, nil
+	}
+
+	output, err := runGitCommandIn(dir, "config", "--show-scope", "--get", "user.email")
+	if err != nil {
+		if gitExitCode(err) == 1 {
+			return "", nil
+		}
+		return "", err
+	}
+	scope, _, _ := strings.Cut(string(output), "\t")
+	return scope, nil
+}
+
+// boundProfile returns the profile whose include file, written by bind,
+// provides the effective user.email of the repository in dir, or an empty
+// string.
+func boundProfile(dir string) (string, error) {
+	output, err := runGitCommandIn(dir, "config", "--show-origin", "--get", "user.email")
+	if err != nil {
+		if gitExitCode(err) == 1 {
+			return "", nil
+		}
+		return "", err
+	}
+
+	origin, _, _ := strings.Cut(string(output), "\t")
+	path, found := strings.CutPrefix(origin, "file:")
+	if !found {
+		return "", nil
+	}
+
+	includeDir, err := getIncludeDir()
+	if err != nil {
+		return "", err
+	}
+	if filepath.Clean(filepath.Dir(filepath.FromSlash(path))) != filepath.Clean(includeDir) {
+		return "", nil
 	}
+	return strings.TrimSuffix(filepath.Base(path), ".gitconfig"), nil
+}
+
+// recordedProfile returns the profile use recorded for the repository in dir
+// and the scope it was recorded in. As in git, the worktree config wins over
+// the local config, which wins over the global config. Outside of a
+// repository only the global config is read.
+func recordedProfile(dir string) (string, string, error) {
+	scopes := []string{scopeGlobal}
+	if _, err := runGitCommandIn(dir, "rev-parse", "--git-dir"); err == nil {
+		scopes = []string{scopeLocal, scopeGlobal}
 
-	// Find matching profile
-	currentName := strings.TrimSpace(string(name))
-	currentEmail := strings.TrimSpace(string(email))
+		worktreeConfig, _, err := getConfigValueIn(dir, "", "extensions.worktreeConfig")
+		if err != nil {
+			return "", "", err
+		}
+		if parseGitBool(worktreeConfig) {
+			scopes = append([]string{scopeWorktree}, scopes...)
+		}
+	}
+
+	for _, scope := range scopes {
+		recorded, exists, err := getConfigValueIn(dir, scope, stateProfileKey)
+		if err != nil {
+			return "", "", err
+		}
+		if exists {
+			return recorded, scope, nil
+		}
+	}
+	return "", "", nil
+}
+
+// staleProfileHint explains what to do about a profile recorded by use for
+// the repository in dir that is not in profiles anymore, usually because it
+// was renamed. It returns an empty string if there is no such profile.
+func staleProfileHint(profiles ProfileMap, dir string) string {
+	recorded, _, err := recordedProfile(dir)
+	if err != nil || recorded == "" {
+		return ""
+	}
+	if _, exists := profiles[recorded]; exists {
+		return ""
+	}
+	return fmt.Sprintf("the profile '%s' recorded by use does not exist anymore, if it was renamed run 'gitprofile rename %s <new-name> --scan <dir>' to update this repository", recorded, recorded)
+}
+
+// matchProfile finds the profile with the given identity for the repository
+// in dir. An empty dir is the current directory.
+func matchProfile(profiles ProfileMap, dir, currentName, currentEmail string) (*Profile, string) {
+	// Prefer the profile recorded by use when several profiles share an identity
+	if recorded, _, err := recordedProfile(dir); err == nil && recorded != "" {
+		if profile, ok := profiles[recorded]; ok && profile.Name == currentName && profile.Email == currentEmail {
+			return &profile, recorded
+		}
+	}
 
 	for profileName, profile := range profiles {
 		if profile.Name == currentName && profile.Email == currentEmail {
-			return &profile, profileName, nil
+			return &profile, profileName
 		}
 	}
 
-	return nil, "", nil
+	return nil, ""
 }
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// systemRegistryPath is a shared, read-only profiles file installed for all
+// users of the machine. It has the lowest precedence of all layers.
+var systemRegistryPath = defaultSystemRegistryPath()
+
+func defaultSystemRegistryPath() string {
+	if runtime.GOOS == "windows" {
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			return ""
+		}
+		return filepath.Join(programData, "gitprofile", "profiles.json")
+	}
+	return "/etc/gitprofile/profiles.json"
+}
+
+// registryPaths returns the read-only profile layers in order of precedence:
+// the registries listed in the settings, then the system registry. Relative
+// paths are resolved against the directory of the profiles file.
+func registryPaths(configPath string, settings Settings) ([]string, error) {
+	var paths []string
+	for _, registry := range settings.Registries {
+		path := registry
+		if !filepath.IsAbs(path) && !strings.HasPrefix(path, "~") {
+			path = filepath.Join(filepath.Dir(configPath), path)
+		}
+		path, err := expandPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid registry path %s: %w", registry, err)
+		}
+		paths = append(paths, path)
+	}
+	if systemRegistryPath != "" {
+		paths = append(paths, systemRegistryPath)
+	}
+	return paths, nil
+}
+
+// loadRegistries reads the read-only profile layers. A profile defined in
+// several layers is taken from the first, and each profile records the file
+// it came from in Origin. Missing registry files are skipped.
+func loadRegistries(configPath string, settings Settings) (ProfileMap, error) {
+	paths, err := registryPaths(configPath, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make(ProfileMap)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read registry %s: %w", path, err)
+		}
+
+		doc, err := decodeConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read registry %s: %w", path, err)
+		}
+
+		for name, profile := range doc.Profiles {
+			if _, exists := profiles[name]; exists {
+				continue
+			}
+			profile.Origin = path
+			profiles[name] = profile
+		}
+	}
+
+	return profiles, nil
+}
+
+// readOnly reports whether the profile comes from a registry rather than the
+// user's profiles file.
+func (p Profile) readOnly() bool {
+	return p.Origin != ""
+}
+
+// errReadOnlyProfile is returned when a registry profile would be modified.
+func errReadOnlyProfile(name string, p Profile) error {
+	return fmt.Errorf("profile '%s' comes from the read-only registry %s, add a profile with the same name to override it", name, p.Origin)
+}
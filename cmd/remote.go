@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// RemoteMatch describes which rule of which profile matched a remote URL.
+type RemoteMatch struct {
+	ProfileName string `json:"profile"`
+	Rule        string `json:"rule"`
+	URL         string `json:"url"`
+}
+
+// normalizeRemote turns remote URLs and rule patterns into a common
+// "host:path" form, so git@github.com:acme/repo.git,
+// https://github.com/acme/repo and github.com/acme/repo compare equal.
+func normalizeRemote(remote string) string {
+	remote = strings.TrimSpace(remote)
+	remote = strings.TrimSuffix(remote, "/")
+	remote = strings.TrimSuffix(remote, ".git")
+
+	if strings.Contains(remote, "://") {
+		if u, err := url.Parse(remote); err == nil {
+			return strings.ToLower(u.Hostname()) + ":" + strings.TrimPrefix(u.Path, "/")
+		}
+	}
+
+	host, repoPath, found := strings.Cut(remote, ":")
+	if !found || strings.Contains(host, "/") {
+		// No scp-style colon, so the first slash separates host and path
+		host, repoPath, found = strings.Cut(remote, "/")
+		if !found {
+			return strings.ToLower(remote)
+		}
+	}
+
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+
+	return strings.ToLower(host) + ":" + repoPath
+}
+
+// matchRemoteRule reports whether a rule pattern matches a remote URL. A
+// pattern without a path matches every repository on that host.
+func matchRemoteRule(rule, remote string) bool {
+	pattern := normalizeRemote(rule)
+	target := normalizeRemote(remote)
+
+	if !strings.Contains(pattern, ":") {
+		host, _, _ := strings.Cut(target, ":")
+		matched, _ := path.Match(pattern, host)
+		return matched
+	}
+
+	matched, _ := path.Match(pattern, target)
+	return matched
+}
+
+// FindRemoteMatch returns the first profile whose remote rules match the
+// given URL. Profiles are evaluated in name order and rules in the order they
+// were added. Host aliases written by ssh-config sync match their real host.
+func FindRemoteMatch(profiles ProfileMap, remote string) *RemoteMatch {
+	target := unaliasRemoteURL(remote)
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, rule := range profiles[name].Remotes {
+			if matchRemoteRule(rule, remote) || matchRemoteRule(rule, target) {
+				return &RemoteMatch{ProfileName: name, Rule: rule, URL: remote}
+			}
+		}
+	}
+
+	return nil
+}
+
+// findRepoRemoteMatch evaluates the remote rules against the URL of a remote
+// of the current repository.
+func findRepoRemoteMatch(profiles ProfileMap, remoteName string) (*RemoteMatch, error) {
+	output, err := runGitCommand("remote", "get-url", remoteName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get url of remote '%s': %w", remoteName, err)
+	}
+
+	remote := strings.TrimSpace(string(output))
+	match := FindRemoteMatch(profiles, remote)
+	if match == nil {
+		return nil, fmt.Errorf("no profile rule matches %s", remote)
+	}
+
+	return match, nil
+}
+
+// remoteURLGlobs converts a rule pattern into the URL globs used by
+// includeIf "hasconfig:remote.*.url:" conditions, covering scp-style, ssh
+// and https remotes.
+func remoteURLGlobs(rule string) []string {
+	host, repoPath, found := strings.Cut(normalizeRemote(rule), ":")
+	if !found {
+		repoPath = "**"
+	}
+
+	paths := []string{repoPath}
+	if !strings.HasSuffix(repoPath, "*") {
+		paths = append(paths, repoPath+".git")
+	}
+
+	var globs []string
+	for _, p := range paths {
+		globs = append(globs,
+			fmt.Sprintf("*@%s:%s", host, p),
+			fmt.Sprintf("ssh://*@%s/%s", host, p),
+			fmt.Sprintf("https://%s/%s", host, p),
+		)
+	}
+	return globs
+}
+
+func NewAutoCmd() *cobra.Command {
+	var remoteName string
+
+	cmd := &cobra.Command{
+		Use:   "auto",
+		Short: "Show which profile matches the current repository",
+		Long: `Evaluate the remote rules of all profiles against the URL of a remote of the
+current repository and report the matching profile and rule.
+Use 'gitprofile use --auto' to activate the matching profile.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := runGitCommand("rev-parse", "--git-dir"); err != nil {
+				return fmt.Errorf("not a git repository (or any of the parent directories)")
+			}
+
+			profiles, err := LoadProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to load profiles: %w", err)
+			}
+
+			match, err := findRepoRemoteMatch(profiles, remoteName)
+			if err != nil {
+				return err
+			}
+
+			w := cmd.OutOrStdout()
+			fmt.Fprintf(w, "Profile: %s\n", match.ProfileName)
+			fmt.Fprintf(w, "  Rule: %s\n", match.Rule)
+			fmt.Fprintf(w, "  Remote: %s (%s)\n", remoteName, match.URL)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&remoteName, "remote", "origin", "Remote whose URL is matched")
+
+	return cmd
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// renameRecordedProfile points the state of one config scope that records
+// oldName at newName. It reports whether the scope recorded oldName.
+func renameRecordedProfile(dir, scope, oldName, newName string) (bool, error) {
+	state, err := loadRepoState(dir, scope)
+	if err != nil {
+		return false, err
+	}
+	if state.Profile != oldName {
+		return false, nil
+	}
+	return true, state.setProfile(newName)
+}
+
+// renameBindings moves the bindings of oldName to the include file of
+// newName and removes the old include file.
+func renameBindings(w io.Writer, oldName, newName string) error {
+	bindings, err := ListBindings()
+	if err != nil {
+		return fmt.Errorf("failed to read global git config: %w", err)
+	}
+
+	var conditions []string
+	for _, binding := range bindings {
+		if binding.Profile == oldName {
+			conditions = append(conditions, binding.Condition)
+		}
+	}
+	if len(conditions) == 0 {
+		return nil
+	}
+
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return fmt.Errorf("failed to load profiles: %w", err)
+	}
+	includePath, err := writeIncludeFile(newName, profiles[newName])
+	if err != nil {
+		return fmt.Errorf("failed to write include file: %w", err)
+	}
+
+	for _, condition := range conditions {
+		if err := addBinding(condition, includePath); err != nil {
+			return fmt.Errorf("failed to update global git config: %w", err)
+		}
+		fmt.Fprintf(w, "Binding %s now uses '%s'\n", condition, newName)
+	}
+
+	return pruneIncludeFiles()
+}
+
+// renameProfile renames a profile in the profiles file, in the profiles
+// extending it, in its bindings and in the global config and the given
+// repositories where use recorded it. Remote URLs of those repositories that
+// use --ssh-alias pointed at the profile's host alias get the new alias.
+// Running it again after the profile was renamed only updates the
+// repositories.
+func renameProfile(w io.Writer, oldName, newName string, repos []string) error {
+	if err := validateProfileName(newName); err != nil {
+		return err
+	}
+
+	renamed := false
+	err := UpdateProfiles(func(profiles ProfileMap) error {
+		profile, exists := profiles[oldName]
+		if !exists {
+			if _, exists := profiles[newName]; exists && len(repos) > 0 {
+				renamed = true
+				return nil
+			}
+			return fmt.Errorf("profile '%s' not found", oldName)
+		}
+		if profile.readOnly() {
+			return errReadOnlyProfile(oldName, profile)
+		}
+		if _, exists := profiles[newName]; exists {
+			return fmt.Errorf("profile '%s' already exists", newName)
+		}
+
+		delete(profiles, oldName)
+		profiles[newName] = profile
+		for name, child := range profiles {
+			if child.Extends == oldName && !child.readOnly() {
+				child.Extends = newName
+				profiles[name] = child
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if renamed {
+		fmt.Fprintf(w, "Profile '%s' was already renamed to '%s'\n", oldName, newName)
+	} else {
+		fmt.Fprintf(w, "Profile '%s' renamed to '%s'\n", oldName, newName)
+	}
+
+	if err := renameBindings(w, oldName, newName); err != nil {
+		return err
+	}
+
+	if renamed, err := renameRecordedProfile("", scopeGlobal, oldName, newName); err != nil {
+		return fmt.Errorf("failed to update global git config: %w", err)
+	} else if renamed {
+		fmt.Fprintln(w, "Updated global git config")
+	}
+
+	for _, repo := range repos {
+		updated := false
+		var remotes []configChange
+		for _, scope := range []string{scopeLocal, scopeWorktree} {
+			renamed, err := renameRecordedProfile(repo, scope, oldName, newName)
+			if err != nil {
+				return fmt.Errorf("failed to update %s: %w", repo, err)
+			}
+			updated = updated || renamed
+
+			changes, err := renameRemoteAliases(repo, scope, oldName, newName)
+			if err != nil {
+				return fmt.Errorf("failed to update remotes of %s: %w", repo, err)
+			}
+			remotes = append(remotes, changes...)
+		}
+		if updated || len(remotes) > 0 {
+			fmt.Fprintf(w, "Updated %s\n", repo)
+		}
+		for _, change := range remotes {
+			fmt.Fprintf(w, "  changed %s: %s -> %s\n", change.Key, change.Old, change.New)
+		}
+	}
+
+	fmt.Fprintf(w, "Other repositories may still record '%s', run 'gitprofile rename %s %s --scan <dir>' to update the ones below a directory\n", oldName, oldName, newName)
+	return nil
+}
+
+// copyProfile stores a copy of the profile src as dst, with another email if
+// email is not empty. Remote rules are not copied as they select a single
+// profile.
+func copyProfile(src, dst, email string) error {
+	if err := validateProfileName(dst); err != nil {
+		return err
+	}
+
+	return UpdateProfiles(func(profiles ProfileMap) error {
+		profile, exists := profiles[src]
+		if !exists {
+			return fmt.Errorf("profile '%s' not found", src)
+		}
+		if _, exists := profiles[dst]; exists {
+			return fmt.Errorf("profile '%s' already exists", dst)
+		}
+
+		profile.Origin = ""
+		profile.Remotes = nil
+		profile.SSHOptions = slices.Clone(profile.SSHOptions)
+		profile.GitConfig = maps.Clone(profile.GitConfig)
+		if email != "" {
+			profile.Email = email
+		}
+
+		profiles[dst] = profile
+		return nil
+	})
+}
+
+// currentRepository returns the top level directory of the repository in
+// the current directory, or an empty string outside of a repository.
+func currentRepository() string {
+	output, err := runGitCommand("rev-parse", "--show-toplevel")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func NewRenameCmd() *cobra.Command {
+	var scanDir string
+
+	cmd := &cobra.Command{
+		Use:   "rename [old-name] [new-name]",
+		Short: "Rename a git profile",
+		Long: `Rename a profile and the profiles extending it. Bindings of the profile are
+moved to the new name, and the profile name recorded by 'use' is updated in
+the global git config, the current repository and with --scan every
+repository below a directory, together with remote URLs that
+'use --ssh-alias' pointed at the profile's host alias. Run
+'gitprofile ssh-config sync' afterwards to write the new alias. Other
+repositories keep the old name; running rename again with --scan after the
+profile was renamed updates them.`,
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var repos []string
+			if repo := currentRepository(); repo != "" {
+				repos = append(repos, repo)
+			}
+			if scanDir != "" {
+				absDir, err := filepath.Abs(scanDir)
+				if err != nil {
+					return err
+				}
+				found, err := findRepositories(absDir)
+				if err != nil {
+					return fmt.Errorf("failed to scan %s: %w", absDir, err)
+				}
+				for _, repo := range found {
+					if !slices.Contains(repos, repo) {
+						repos = append(repos, repo)
+					}
+				}
+			}
+
+			return renameProfile(cmd.OutOrStdout(), args[0], args[1], repos)
+		},
+		ValidArgsFunction: ValidProfileArgsForUse,
+	}
+
+	cmd.Flags().StringVar(&scanDir, "scan", "", "Also update repositories below this directory")
+	cmd.MarkFlagDirname("scan")
+
+	return cmd
+}
+
+func NewCopyCmd() *cobra.Command {
+	var email string
+
+	cmd := &cobra.Command{
+		Use:   "copy [source] [new-name]",
+		Short: "Copy a git profile",
+		Long: `Create a profile from a copy of another, optionally with a different email.
+Remote rules are not copied. Profiles from a registry can be copied to get an
+editable version of them.`,
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := copyProfile(args[0], args[1], email); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Profile '%s' copied to '%s'\n", args[0], args[1])
+			return nil
+		},
+		ValidArgsFunction: ValidProfileArgsForUse,
+	}
+
+	cmd.Flags().StringVar(&email, "email", "", "Email of the new profile")
+
+	return cmd
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The state gitprofile keeps about a repository lives in the config file it
+// describes (local, worktree or global), next to the keys it manages:
+//
+//	[gitprofile]
+//		profile = work
+//		managed = user.name
+//		managed = user.email
+//	[gitprofile "previous.user"]
+//		name = Jane Doe
+//
+// "managed" lists every key written by use, "previous.<key>" holds the value
+// a key had before gitprofile first wrote it. Remote URLs rewritten by
+// use --ssh-alias are not managed, only their original value is kept in
+// "previous.remote.<name>.url".
+const (
+	stateProfileKey  = "gitprofile.profile"
+	stateManagedKey  = "gitprofile.managed"
+	statePreviousKey = "gitprofile.previous."
+)
+
+// repoState is the gitprofile bookkeeping of a single config scope.
+type repoState struct {
+	Profile  string
+	Managed  []string
+	Previous map[string]string
+
+	dir   string
+	scope string
+}
+
+// loadRepoState reads the gitprofile state from the config file of scope of
+// the repository in dir. An empty dir is the current directory.
+func loadRepoState(dir, scope string) (*repoState, error) {
+	entries, err := getConfigRegexpIn(dir, scope, `^gitprofile\.`)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &repoState{Previous: make(map[string]string), dir: dir, scope: scope}
+	for _, entry := range entries {
+		switch {
+		case entry.Key == stateProfileKey:
+			state.Profile = entry.Value
+		case entry.Key == stateManagedKey:
+			state.Managed = append(state.Managed, entry.Value)
+		case strings.HasPrefix(entry.Key, statePreviousKey):
+			state.Previous[strings.TrimPrefix(entry.Key, statePreviousKey)] = entry.Value
+		}
+	}
+
+	return state, nil
+}
+
+// IsManaged reports whether key was written by gitprofile.
+func (s *repoState) IsManaged(key string) bool {
+	for _, managed := range s.Managed {
+		if strings.EqualFold(managed, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// PreviousValue returns the value key had before gitprofile managed it.
+func (s *repoState) PreviousValue(key string) (string, bool) {
+	for k, value := range s.Previous {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// manageKey records that gitprofile is about to write key. The first time a
+// key is managed, its current local value (if any) is kept as snapshot.
+func (s *repoState) manageKey(key, value string, exists bool) error {
+	if s.IsManaged(key) {
+		return nil
+	}
+
+	if exists {
+		if err := s.setPrevious(key, value); err != nil {
+			return err
+		}
+	}
+
+	if _, err := runGitCommandIn(s.dir, "config", s.scope, "--add", stateManagedKey, key); err != nil {
+		return err
+	}
+	s.Managed = append(s.Managed, key)
+
+	return nil
+}
+
+// setPrevious records the value key had before gitprofile changed it.
+func (s *repoState) setPrevious(key, value string) error {
+	if _, err := runGitCommandIn(s.dir, "config", s.scope, statePreviousKey+key, value); err != nil {
+		return err
+	}
+	s.Previous[key] = value
+	return nil
+}
+
+// releaseKey forgets that gitprofile wrote key, together with the value it
+// had before, so a value set by hand later is left alone.
+func (s *repoState) releaseKey(key string) error {
+	pattern := "^" + regexp.QuoteMeta(key) + "$"
+	if _, err := runGitCommandIn(s.dir, "config", s.scope, "--unset-all", stateManagedKey, pattern); err != nil && gitExitCode(err) != 5 {
+		return err
+	}
+
+	for k := range s.Previous {
+		if !strings.EqualFold(k, key) {
+			continue
+		}
+		if _, err := runGitCommandIn(s.dir, "config", s.scope, "--unset-all", statePreviousKey+k); err != nil && gitExitCode(err) != 5 {
+			return err
+		}
+		delete(s.Previous, k)
+	}
+
+	managed := s.Managed[:0]
+	for _, k := range s.Managed {
+		if !strings.EqualFold(k, key) {
+			managed = append(managed, k)
+		}
+	}
+	s.Managed = managed
+
+	return nil
+}
+
+// setProfile records the name of the active profile.
+func (s *repoState) setProfile(profileName string) error {
+	if _, err := runGitCommandIn(s.dir, "config", s.scope, stateProfileKey, profileName); err != nil {
+		return err
+	}
+	s.Profile = profileName
+	return nil
+}
+
+// clear removes all gitprofile bookkeeping from the local config.
+func (s *repoState) clear() error {
+	sections := []string{"gitprofile"}
+	seen := map[string]bool{"gitprofile": true}
+	for key := range s.Previous {
+		section := statePreviousKey + key[:strings.LastIndex(key, ".")]
+		if !seen[section] {
+			seen[section] = true
+			sections = append(sections, section)
+		}
+	}
+
+	if s.Profile == "" && len(s.Managed) == 0 {
+		sections = sections[1:]
+	}
+
+	for _, section := range sections {
+		if _, err := runGitCommandIn(s.dir, "config", s.scope, "--remove-section", section); err != nil {
+			return fmt.Errorf("failed to remove section %s: %w", section, err)
+		}
+	}
+
+	*s = repoState{Previous: make(map[string]string), dir: s.dir, scope: s.scope}
+	return nil
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// identityStatus classifies the effective identity of a repository.
+type identityStatus string
+
+const (
+	identityProfile identityStatus = "profile"
+	identityUnset   identityStatus = "unset"
+	identityCustom  identityStatus = "custom"
+	identityError   identityStatus = "error"
+)
+
+// scanResult is the identity found in one repository and where it comes
+// from, one of the sources reported by identitySource.
+type scanResult struct {
+	Repository string         `json:"repository"`
+	Status     identityStatus `json:"status"`
+	Source     string         `json:"source,omitempty"`
+	Profile    string         `json:"profile,omitempty"`
+	Name       string         `json:"name,omitempty"`
+	Email      string         `json:"email,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// mismatched reports whether the repository needs attention: its identity
+// belongs to no profile, is not set anywhere, or could not be read.
+func (r scanResult) mismatched() bool {
+	return r.Status != identityProfile
+}
+
+// scanRepository reads the effective identity of the repository in dir, as
+// git would use it for a commit, and matches it against the profiles with
+// currentProfile, so bindings and worktree configs are taken into account.
+func scanRepository(dir string) scanResult {
+	result := scanResult{Repository: dir}
+	fail := func(err error) scanResult {
+		result.Status, result.Error = identityError, err.Error()
+		return result
+	}
+
+	name, nameSet, err := getConfigValueIn(dir, "", "user.name")
+	if err != nil {
+		return fail(err)
+	}
+	email, emailSet, err := getConfigValueIn(dir, "", "user.email")
+	if err != nil {
+		return fail(err)
+	}
+
+	if !nameSet && !emailSet {
+		result.Status = identityUnset
+		return result
+	}
+	result.Name, result.Email = name, email
+
+	_, profileName, source, err := currentProfile(dir)
+	if err != nil {
+		return fail(err)
+	}
+	if profileName != "" {
+		result.Status, result.Profile, result.Source = identityProfile, profileName, source
+		return result
+	}
+
+	if result.Source, err = identitySource(dir); err != nil {
+		return fail(err)
+	}
+	result.Status = identityCustom
+	return result
+}
+
+func NewScanCmd() *cobra.Command {
+	var format string
+	var mismatchedOnly bool
+
+	cmd := &cobra.Command{
+		Use:   "scan [directory]",
+		Short: "Report the identity of every repository below a directory",
+		Long: `Find all repositories below a directory and report for each whether the
+identity git would commit with belongs to a profile, is not set at all or is a
+custom identity that matches no profile, and where it comes from: a directory
+binding, or the global, local or worktree config.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" && format != "csv" {
+				return fmt.Errorf("invalid format '%s' (must be table, json or csv)", format)
+			}
+
+			if _, err := LoadProfiles(); err != nil {
+				return fmt.Errorf("failed to load profiles: %w", err)
+			}
+
+			root, err := expandPath(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid directory: %w", err)
+			}
+
+			repos, err := findRepositories(root)
+			if err != nil {
+				return fmt.Errorf("failed to scan %s: %w", root, err)
+			}
+
+			results := []scanResult{}
+			for _, repo := range repos {
+				result := scanRepository(repo)
+				if mismatchedOnly && !result.mismatched() {
+					continue
+				}
+				results = append(results, result)
+			}
+
+			w := cmd.OutOrStdout()
+
+			switch format {
+			case "json":
+				encoder := json.NewEncoder(w)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(results)
+			case "csv":
+				writer := csv.NewWriter(w)
+				writer.Write([]string{"repository", "status", "source", "profile", "name", "email", "error"})
+				for _, result := range results {
+					writer.Write([]string{result.Repository, string(result.Status), result.Source, result.Profile, result.Name, result.Email, result.Error})
+				}
+				writer.Flush()
+				return writer.Error()
+			}
+
+			if len(results) == 0 {
+				fmt.Fprintf(w, "No repositories to report below %s\n", root)
+				return nil
+			}
+
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "REPOSITORY\tSTATUS\tSOURCE\tPROFILE\tIDENTITY")
+			for _, result := range results {
+				dir := result.Repository
+				if rel, err := filepath.Rel(root, dir); err == nil {
+					dir = rel
+				}
+
+				identity := "-"
+				switch result.Status {
+				case identityError:
+					identity = result.Error
+				case identityProfile, identityCustom:
+					identity = fmt.Sprintf("%s <%s>", result.Name, result.Email)
+				}
+
+				source, profileName := result.Source, result.Profile
+				if source == "" {
+					source = "-"
+				}
+				if profileName == "" {
+					profileName = "-"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", dir, result.Status, source, profileName, identity)
+			}
+			return tw.Flush()
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return nil, cobra.ShellCompDirectiveFilterDirs
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "table", "Output format (table, json or csv)")
+	cmd.Flags().BoolVar(&mismatchedOnly, "mismatched-only", false, "Only report repositories with a custom or unset identity, or errors")
+	cmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"table", "json", "csv"}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return cmd
+}
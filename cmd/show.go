@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// profileField is a displayed field of a profile and the key of its origin.
+type profileField struct {
+	Label  string
+	Value  string
+	Origin string
+}
+
+// profileFields lists the fields of a profile that are set, in display order.
+func profileFields(p Profile) []profileField {
+	fields := []profileField{
+		{Label: "Name", Value: p.Name, Origin: fieldName},
+		{Label: "Email", Value: p.Email, Origin: fieldEmail},
+	}
+
+	optional := []profileField{
+		{Label: "GPG Key", Value: p.GPGKey, Origin: fieldSigning},
+		{Label: "Signing Format", Value: p.SigningFormat, Origin: fieldSigning},
+		{Label: "Allowed Signers", Value: p.AllowedSignersFile, Origin: fieldSigning},
+		{Label: "X509 Program", Value: p.X509Program, Origin: fieldSigning},
+		{Label: "SSH Key", Value: p.SSHKey, Origin: fieldSSH},
+	}
+	if p.hasSSHOptions() {
+		command, err := p.sshCommand()
+		if err != nil {
+			command = fmt.Sprintf("invalid (%v)", err)
+		}
+		optional = append(optional, profileField{Label: "SSH Command", Value: command, Origin: fieldSSH})
+	}
+	optional = append(optional, profileField{Label: "Remotes", Value: strings.Join(p.Remotes, ", ")})
+
+	for _, field := range optional {
+		if field.Value != "" {
+			fields = append(fields, field)
+		}
+	}
+	fields = append(fields, profileField{Label: "Sign Commits", Value: strconv.FormatBool(p.signsCommits()), Origin: fieldSignCommits})
+
+	for _, entry := range p.sortedGitConfig() {
+		fields = append(fields, profileField{Label: "Git Config " + entry.Key, Value: entry.Value, Origin: gitConfigField(entry.Key)})
+	}
+
+	return fields
+}
+
+func NewShowCmd() *cobra.Command {
+	var resolved bool
+
+	cmd := &cobra.Command{
+		Use:   "show [profile-name]",
+		Short: "Show a single git profile",
+		Long: `Show the fields of a profile as stored. With --resolved the fields inherited
+through 'extends' are included and each field names the profile it came from.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profileName := args[0]
+			profiles, err := LoadRawProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to load profiles: %w", err)
+			}
+
+			profile, exists := profiles[profileName]
+			if !exists {
+				return fmt.Errorf("profile '%s' not found", profileName)
+			}
+
+			w := cmd.OutOrStdout()
+			fmt.Fprintf(w, "Profile: %s\n", profileName)
+
+			if !resolved {
+				if profile.Extends != "" {
+					fmt.Fprintf(w, "  Extends: %s\n", profile.Extends)
+				}
+				for _, field := range profileFields(profile) {
+					fmt.Fprintf(w, "  %s: %s\n", field.Label, field.Value)
+				}
+				return nil
+			}
+
+			chain, err := extendsChain(profiles, profileName)
+			if err != nil {
+				return err
+			}
+			resolvedProfile, origins, err := resolveProfile(profiles, profileName)
+			if err != nil {
+				return err
+			}
+
+			if len(chain) > 1 {
+				fmt.Fprintf(w, "  Inherits: %s\n", strings.Join(chain, " -> "))
+			}
+
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			for _, field := range profileFields(resolvedProfile) {
+				origin := profileName
+				if field.Origin != "" {
+					origin = origins[field.Origin]
+				}
+				switch origin {
+				case "":
+					origin = "default"
+				case profileName:
+					origin = "own"
+				default:
+					origin = "from " + origin
+				}
+				fmt.Fprintf(tw, "  %s:\t%s\t(%s)\n", field.Label, field.Value, origin)
+			}
+			return tw.Flush()
+		},
+		ValidArgsFunction: ValidProfileArgsForUse,
+	}
+
+	cmd.Flags().BoolVar(&resolved, "resolved", false, "Include inherited fields and show where each field comes from")
+
+	return cmd
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// defaultSSHProgram is used for core.sshCommand when a profile does not name
+// another ssh binary.
+const defaultSSHProgram = "ssh"
+
+// sshOptionPattern matches an ssh -o option in Keyword=value form.
+var sshOptionPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*=\S.*$`)
+
+// hasSSHOptions reports whether the profile customizes ssh beyond the key.
+func (p Profile) hasSSHOptions() bool {
+	return p.SSHProgram != "" || p.SSHPort != 0 || p.identitiesOnly() || len(p.SSHOptions) > 0
+}
+
+// containsControl reports whether s contains characters that cannot be
+// written to a single git config value or shell word safely.
+func containsControl(s string) bool {
+	return strings.IndexFunc(s, unicode.IsControl) >= 0
+}
+
+// sshCommandArgs returns the argument vector of the profile's ssh command
+// with paths expanded, or nil if the profile does not configure ssh.
+func (p Profile) sshCommandArgs() ([]string, error) {
+	if p.SSHKey == "" && !p.hasSSHOptions() {
+		return nil, nil
+	}
+
+	program := p.SSHProgram
+	if program == "" {
+		program = defaultSSHProgram
+	}
+	if strings.TrimSpace(program) == "" || containsControl(program) {
+		return nil, fmt.Errorf("invalid ssh program %q", program)
+	}
+	// Bare names are looked up in PATH, only paths are expanded
+	if strings.HasPrefix(program, "~") || strings.ContainsAny(program, `/\`) {
+		expanded, err := expandPath(program)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh program %s: %w", program, err)
+		}
+		program = expanded
+	}
+	args := []string{program}
+
+	if p.SSHKey != "" {
+		if containsControl(p.SSHKey) {
+			return nil, fmt.Errorf("invalid ssh key path %q", p.SSHKey)
+		}
+		key, err := expandPath(p.SSHKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh key path %s: %w", p.SSHKey, err)
+		}
+		args = append(args, "-i", key)
+	}
+
+	if p.identitiesOnly() {
+		if p.SSHKey == "" {
+			return nil, fmt.Errorf("IdentitiesOnly requires an ssh key")
+		}
+		args = append(args, "-o", "IdentitiesOnly=yes")
+	}
+
+	if p.SSHPort != 0 {
+		if p.SSHPort < 1 || p.SSHPort > 65535 {
+			return nil, fmt.Errorf("invalid ssh port %d", p.SSHPort)
+		}
+		args = append(args, "-p", strconv.Itoa(p.SSHPort))
+	}
+
+	for _, option := range p.SSHOptions {
+		if !sshOptionPattern.MatchString(option) || containsControl(option) {
+			return nil, fmt.Errorf("invalid ssh option '%s' (expected Keyword=value)", option)
+		}
+		args = append(args, "-o", option)
+	}
+
+	return args, nil
+}
+
+// sshCommand returns the quoted core.sshCommand of the profile, or an empty
+// string if the profile does not configure ssh. The command is parsed back
+// to make sure the shell git runs it with sees the same arguments.
+func (p Profile) sshCommand() (string, error) {
+	args, err := p.sshCommandArgs()
+	if err != nil || args == nil {
+		return "", err
+	}
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	command := strings.Join(quoted, " ")
+
+	parsed, err := splitShellWords(command)
+	if err != nil {
+		return "", fmt.Errorf("invalid ssh command %s: %w", command, err)
+	}
+	if strings.Join(parsed, "\x00") != strings.Join(args, "\x00") {
+		return "", fmt.Errorf("ssh command %s does not round-trip through the shell", command)
+	}
+
+	return command, nil
+}
+
+// checkSSH validates the ssh settings of a profile before they are applied.
+func (p Profile) checkSSH() error {
+	_, err := p.sshCommand()
+	return err
+}
+
+// splitShellWords splits a command line the way a POSIX shell does for the
+// subset of syntax used in ssh commands: whitespace, single quotes, double
+// quotes and backslash escapes.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			if i+1 >= len(s) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,529 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	sshConfigBegin     = "# BEGIN gitprofile managed block, regenerated by 'gitprofile ssh-config sync'"
+	sshConfigEnd       = "# END gitprofile managed block"
+	defaultSSHHostName = "github.com"
+)
+
+// sshHostAlias is a Host entry that pins a profile's key to a git host.
+type sshHostAlias struct {
+	Alias        string
+	HostName     string
+	IdentityFile string
+	Port         int
+	Options      []string
+}
+
+// getSSHConfigPath returns the path of the user's ssh config.
+func getSSHConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".ssh", "config"), nil
+}
+
+// sshAliasName returns the alias of a git host for a profile.
+func sshAliasName(host, profileName string) string {
+	return host + "-" + profileName
+}
+
+// profileSSHHosts returns the hosts named by the profile's remote rules, or
+// the default host when the rules name none.
+func profileSSHHosts(profile Profile, defaultHost string) []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, rule := range profile.Remotes {
+		host, _, _ := strings.Cut(normalizeRemote(rule), ":")
+		if host == "" || strings.ContainsAny(host, "*?[") || seen[host] {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+
+	if len(hosts) == 0 {
+		hosts = append(hosts, defaultHost)
+	}
+	return hosts
+}
+
+// sshHostAliases returns one alias per host of every profile with an SSH key,
+// sorted by alias.
+func sshHostAliases(profiles ProfileMap, settings Settings) []sshHostAlias {
+	defaultHost := settings.DefaultSSHHost
+	if defaultHost == "" {
+		defaultHost = defaultSSHHostName
+	}
+
+	var aliases []sshHostAlias
+	for name, profile := range profiles {
+		if profile.SSHKey == "" {
+			continue
+		}
+		for _, host := range profileSSHHosts(profile, defaultHost) {
+			aliases = append(aliases, sshHostAlias{
+				Alias:        sshAliasName(host, name),
+				HostName:     host,
+				IdentityFile: profile.SSHKey,
+				Port:         profile.SSHPort,
+				Options:      profile.SSHOptions,
+			})
+		}
+	}
+
+	sort.Slice(aliases, func(i, j int) bool {
+		return aliases[i].Alias < aliases[j].Alias
+	})
+	return aliases
+}
+
+// sshConfigQuote quotes an ssh_config argument containing whitespace.
+func sshConfigQuote(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// renderSSHConfigBlock returns the managed block for the aliases, including
+// its delimiters.
+func renderSSHConfigBlock(aliases []sshHostAlias) string {
+	var b strings.Builder
+	b.WriteString(sshConfigBegin + "\n")
+	for _, alias := range aliases {
+		fmt.Fprintf(&b, "Host %s\n", alias.Alias)
+		fmt.Fprintf(&b, "    HostName %s\n", alias.HostName)
+		fmt.Fprintf(&b, "    IdentityFile %s\n", sshConfigQuote(alias.IdentityFile))
+		b.WriteString("    IdentitiesOnly yes\n")
+		if alias.Port != 0 {
+			fmt.Fprintf(&b, "    Port %d\n", alias.Port)
+		}
+		// ssh_config accepts the same Keyword=value form as -o
+		for _, option := range alias.Options {
+			fmt.Fprintf(&b, "    %s\n", option)
+		}
+	}
+	b.WriteString(sshConfigEnd + "\n")
+	return b.String()
+}
+
+// replaceSSHConfigBlock swaps the managed block in content for block. Without
+// an existing block it is appended, as lines following a Host entry would
+// otherwise become part of it.
+func replaceSSHConfigBlock(content, block string) (string, error) {
+	start := strings.Index(content, sshConfigBegin)
+	if start < 0 {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if content != "" {
+			content += "\n"
+		}
+		return content + block, nil
+	}
+
+	end := strings.Index(content[start:], sshConfigEnd)
+	if end < 0 {
+		return "", fmt.Errorf("found the start of the gitprofile block but not its end marker '%s'", sshConfigEnd)
+	}
+	end += start + len(sshConfigEnd)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+
+	return content[:start] + block + content[end:], nil
+}
+
+// readSSHConfig returns the content of the ssh config, empty if it does not
+// exist yet.
+func readSSHConfig(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// managedSSHBlock returns the lines of the managed block of an ssh config,
+// without its delimiters.
+func managedSSHBlock(content string) []string {
+	start := strings.Index(content, sshConfigBegin)
+	if start < 0 {
+		return nil
+	}
+	end := strings.Index(content[start:], sshConfigEnd)
+	if end < 0 {
+		return nil
+	}
+	return strings.Split(content[start+len(sshConfigBegin):start+end], "\n")
+}
+
+// sshConfigHasHost reports whether the managed block defines a Host alias.
+func sshConfigHasHost(content, alias string) bool {
+	for _, line := range managedSSHBlock(content) {
+		if strings.TrimSpace(line) == "Host "+alias {
+			return true
+		}
+	}
+	return false
+}
+
+// managedSSHHosts returns the real host of every alias in the managed block
+// of the user's ssh config. Without a readable ssh config there are none.
+func managedSSHHosts() map[string]string {
+	hosts := make(map[string]string)
+	path, err := getSSHConfigPath()
+	if err != nil {
+		return hosts
+	}
+	content, err := readSSHConfig(path)
+	if err != nil {
+		return hosts
+	}
+
+	var alias string
+	for _, line := range managedSSHBlock(content) {
+		keyword, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch keyword {
+		case "Host":
+			alias = value
+		case "HostName":
+			if alias != "" {
+				hosts[alias] = value
+			}
+		}
+	}
+	return hosts
+}
+
+// unaliasHost returns the real host of a host alias written by ssh-config
+// sync. Other hosts are returned unchanged, even if they look like an alias.
+func unaliasHost(hosts map[string]string, host string) string {
+	if hostName, ok := hosts[host]; ok {
+		return hostName
+	}
+	return host
+}
+
+// rewriteSSHHost replaces the host of an ssh remote URL, either ssh:// or
+// scp-style [user@]host:path.
+func rewriteSSHHost(remote string, rewrite func(host string) string) (string, error) {
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return "", fmt.Errorf("invalid remote url %s: %w", remote, err)
+		}
+		if u.Scheme != "ssh" {
+			return "", fmt.Errorf("remote %s does not use ssh", remote)
+		}
+		host := rewrite(u.Hostname())
+		if port := u.Port(); port != "" {
+			host += ":" + port
+		}
+		u.Host = host
+		return u.String(), nil
+	}
+
+	hostPart, repoPath, found := strings.Cut(remote, ":")
+	if !found || strings.Contains(hostPart, "/") {
+		return "", fmt.Errorf("remote %s does not use ssh", remote)
+	}
+	user := ""
+	if i := strings.LastIndex(hostPart, "@"); i >= 0 {
+		user, hostPart = hostPart[:i+1], hostPart[i+1:]
+	}
+	return user + rewrite(hostPart) + ":" + repoPath, nil
+}
+
+// aliasRemoteURL rewrites the host of an ssh remote URL to the profile's
+// alias. An alias in hosts is replaced, so switching profiles keeps working.
+func aliasRemoteURL(remote, profileName string, hosts map[string]string) (string, error) {
+	return rewriteSSHHost(remote, func(host string) string {
+		return sshAliasName(unaliasHost(hosts, host), profileName)
+	})
+}
+
+// unaliasRemoteURL returns the URL with any host alias of the ssh config
+// removed, or the URL unchanged if it is not an ssh URL.
+func unaliasRemoteURL(remote string) string {
+	hosts := managedSSHHosts()
+	unaliased, err := rewriteSSHHost(remote, func(host string) string {
+		return unaliasHost(hosts, host)
+	})
+	if err != nil {
+		return remote
+	}
+	return unaliased
+}
+
+// remoteURLKey returns the config key of a remote's URL.
+func remoteURLKey(remoteName string) string {
+	return "remote." + remoteName + ".url"
+}
+
+// recordedRemoteURLs returns the original URLs of the remotes that
+// use --ssh-alias rewrote, keyed by remote name.
+func recordedRemoteURLs(state *repoState) map[string]string {
+	urls := make(map[string]string)
+	for key, value := range state.Previous {
+		if !strings.HasPrefix(key, "remote.") || !strings.HasSuffix(key, ".url") {
+			continue
+		}
+		urls[strings.TrimSuffix(strings.TrimPrefix(key, "remote."), ".url")] = value
+	}
+	return urls
+}
+
+// planRemoteAlias returns the change of a remote's URL to the profile's host
+// alias, or nil if the URL already uses it. The alias is derived from the URL
+// the remote had before the first use --ssh-alias.
+func planRemoteAlias(state *repoState, remoteName, profileName string, profiles ProfileMap) (*configChange, error) {
+	if profiles[profileName].SSHKey == "" {
+		return nil, fmt.Errorf("profile '%s' has no SSH key to create a host alias for", profileName)
+	}
+
+	output, err := runGitCommandIn(state.dir, "remote", "get-url", remoteName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get url of remote '%s': %w", remoteName, err)
+	}
+
+	current := strings.TrimSpace(string(output))
+	original, recorded := recordedRemoteURLs(state)[remoteName]
+	if !recorded {
+		original = current
+	}
+	aliased, err := aliasRemoteURL(original, profileName, managedSSHHosts())
+	if err != nil {
+		return nil, err
+	}
+	if aliased == current {
+		return nil, nil
+	}
+
+	return &configChange{Action: actionChange, Key: remoteURLKey(remoteName), Old: current, New: aliased}, nil
+}
+
+// applyRemoteAlias sets the URL of a remote to its alias and records the URL
+// it had before, unless an earlier use --ssh-alias already did.
+func applyRemoteAlias(state *repoState, remoteName string, change *configChange) error {
+	if _, recorded := recordedRemoteURLs(state)[remoteName]; !recorded {
+		if err := state.setPrevious(remoteURLKey(remoteName), change.Old); err != nil {
+			return fmt.Errorf("failed to record url of remote '%s': %w", remoteName, err)
+		}
+	}
+	if _, err := runGitCommandIn(state.dir, "remote", "set-url", remoteName, change.New); err != nil {
+		return fmt.Errorf("failed to set url of remote '%s': %w", remoteName, err)
+	}
+	return nil
+}
+
+// planRemoteRestores returns the changes that put back the original URLs of
+// the remotes rewritten by use --ssh-alias, except the remote keep.
+func planRemoteRestores(state *repoState, keep string) ([]configChange, error) {
+	urls := recordedRemoteURLs(state)
+	names := make([]string, 0, len(urls))
+	for name := range urls {
+		if name != keep {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []configChange
+	for _, name := range names {
+		current, exists, err := getConfigValueIn(state.dir, "", remoteURLKey(name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read url of remote '%s': %w", name, err)
+		}
+		if exists && current != urls[name] {
+			changes = append(changes, configChange{Action: actionChange, Key: remoteURLKey(name), Old: current, New: urls[name]})
+		}
+	}
+	return changes, nil
+}
+
+// restoreRemoteURLs applies the changes of planRemoteRestores and forgets the
+// original URLs of all remotes but keep.
+func restoreRemoteURLs(state *repoState, changes []configChange, keep string) error {
+	for _, change := range changes {
+		name := strings.TrimSuffix(strings.TrimPrefix(change.Key, "remote."), ".url")
+		if _, err := runGitCommandIn(state.dir, "remote", "set-url", name, change.New); err != nil {
+			return fmt.Errorf("failed to restore url of remote '%s': %w", name, err)
+		}
+	}
+	for name := range recordedRemoteURLs(state) {
+		if name == keep {
+			continue
+		}
+		if err := state.releaseKey(remoteURLKey(name)); err != nil {
+			return fmt.Errorf("failed to forget url of remote '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// renameRemoteAliases points the remotes that use --ssh-alias rewrote to a
+// host alias of oldName, as recorded in the state of scope of the repository
+// in dir, at the same alias of newName.
+func renameRemoteAliases(dir, scope, oldName, newName string) ([]configChange, error) {
+	state, err := loadRepoState(dir, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := recordedRemoteURLs(state)
+	names := make([]string, 0, len(urls))
+	for name := range urls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []configChange
+	for _, name := range names {
+		current, exists, err := getConfigValueIn(dir, "", remoteURLKey(name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read url of remote '%s': %w", name, err)
+		}
+		if !exists {
+			continue
+		}
+
+		renamed, err := rewriteSSHHost(current, func(host string) string {
+			if base, found := strings.CutSuffix(host, "-"+oldName); found {
+				return sshAliasName(base, newName)
+			}
+			return host
+		})
+		if err != nil || renamed == current {
+			continue
+		}
+
+		if _, err := runGitCommandIn(dir, "remote", "set-url", name, renamed); err != nil {
+			return nil, fmt.Errorf("failed to set url of remote '%s': %w", name, err)
+		}
+		changes = append(changes, configChange{Action: actionChange, Key: remoteURLKey(name), Old: current, New: renamed})
+	}
+	return changes, nil
+}
+
+// printSSHAliasHint reminds the user to run ssh-config sync when the host
+// alias of a remote URL is missing from the ssh config.
+func printSSHAliasHint(w io.Writer, remote string) {
+	var alias string
+	rewriteSSHHost(remote, func(host string) string {
+		alias = host
+		return host
+	})
+
+	path, err := getSSHConfigPath()
+	if err != nil {
+		return
+	}
+	content, err := readSSHConfig(path)
+	if err != nil || !sshConfigHasHost(content, alias) {
+		fmt.Fprintf(w, "Host alias %s is not in %s yet, run 'gitprofile ssh-config sync'\n", alias, path)
+	}
+}
+
+func newSSHConfigSyncCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Write Host aliases for all profiles to ~/.ssh/config",
+		Long: `Regenerate the gitprofile block in ~/.ssh/config with a Host alias such as
+github.com-work for every profile with an SSH key. The aliases use only the
+profile's key (IdentitiesOnly yes), so ssh-agent cannot offer another key
+first. The hosts are taken from the profile's remote rules and default to
+github.com, or settings.default_ssh_host in the profiles file. Entries outside
+the block are never modified.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profiles, err := LoadProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to load profiles: %w", err)
+			}
+
+			path, err := getSSHConfigPath()
+			if err != nil {
+				return fmt.Errorf("failed to locate ssh config: %w", err)
+			}
+
+			content, err := readSSHConfig(path)
+			if err != nil {
+				return fmt.Errorf("failed to read ssh config: %w", err)
+			}
+
+			for name, profile := range profiles {
+				if err := profile.checkSSH(); err != nil {
+					return fmt.Errorf("invalid ssh configuration of profile '%s': %w", name, err)
+				}
+			}
+
+			settings, err := LoadSettings()
+			if err != nil {
+				return fmt.Errorf("failed to load settings: %w", err)
+			}
+
+			aliases := sshHostAliases(profiles, settings)
+			block := renderSSHConfigBlock(aliases)
+
+			w := cmd.OutOrStdout()
+
+			if dryRun {
+				fmt.Fprint(w, block)
+				return nil
+			}
+
+			updated, err := replaceSSHConfigBlock(content, block)
+			if err != nil {
+				return err
+			}
+
+			if updated != content {
+				if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+					return fmt.Errorf("failed to create ssh directory: %w", err)
+				}
+				if err := writeFileAtomic(path, []byte(updated), 0600); err != nil {
+					return fmt.Errorf("failed to write ssh config: %w", err)
+				}
+			}
+
+			fmt.Fprintf(w, "Wrote %d host alias(es) to %s\n", len(aliases), path)
+			for _, alias := range aliases {
+				fmt.Fprintf(w, "  %s -> %s (%s)\n", alias.Alias, alias.HostName, alias.IdentityFile)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the block instead of writing it")
+
+	return cmd
+}
+
+func NewSSHConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ssh-config",
+		Short: "Manage per-profile SSH host aliases",
+		Long:  `Manage Host aliases in ~/.ssh/config that pin each profile to its SSH key`,
+	}
+
+	cmd.AddCommand(newSSHConfigSyncCmd())
+
+	return cmd
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -10,22 +11,33 @@ func NewStatusCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show current git profile",
-		Long:  `Display the active git profile in the current repository`,
-		Args:  cobra.NoArgs,
+		Long: `Display the profile matching the effective identity of the current
+repository and whether it comes from the worktree, repository or global git
+config or from a directory binding.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			profile, profileName, err := GetCurrentProfile()
+			profile, profileName, source, err := currentProfile("")
 			if err != nil {
 				return fmt.Errorf("failed to get current profile: %w", err)
 			}
 
 			w := cmd.OutOrStdout()
 
+			if profiles, err := LoadProfiles(); err == nil {
+				if hint := staleProfileHint(profiles, ""); hint != "" {
+					fmt.Fprintf(w, "Warning: %s\n", hint)
+				}
+			}
+
 			if profile == nil {
 				fmt.Fprintln(w, "No active profile found")
 				return nil
 			}
 
-			fmt.Fprintf(w, "Active profile: %s\n", profileName)
+			fmt.Fprintf(w, "Active profile: %s (from %s)\n", profileName, sourceDescription(source))
+			if profile.Extends != "" {
+				fmt.Fprintf(w, "  Extends: %s\n", profile.Extends)
+			}
 			fmt.Fprintf(w, "  Name: %s\n", profile.Name)
 			fmt.Fprintf(w, "  Email: %s\n", profile.Email)
 			if profile.GPGKey != "" {
@@ -34,7 +46,26 @@ func NewStatusCmd() *cobra.Command {
 			if profile.SSHKey != "" {
 				fmt.Fprintf(w, "  SSH Key: %s\n", profile.SSHKey)
 			}
-			fmt.Fprintf(w, "  Sign Commits: %v\n", profile.SignCommits)
+			if profile.hasSSHOptions() {
+				if command, err := profile.sshCommand(); err == nil {
+					fmt.Fprintf(w, "  SSH Command: %s\n", command)
+				} else {
+					fmt.Fprintf(w, "  SSH Command: invalid (%v)\n", err)
+				}
+			}
+			fmt.Fprintf(w, "  Sign Commits: %v\n", profile.signsCommits())
+			if profile.SigningFormat != "" {
+				fmt.Fprintf(w, "  Signing Format: %s\n", profile.SigningFormat)
+			}
+			if len(profile.Remotes) > 0 {
+				fmt.Fprintf(w, "  Remotes: %s\n", strings.Join(profile.Remotes, ", "))
+			}
+			if len(profile.GitConfig) > 0 {
+				fmt.Fprintln(w, "  Git Config:")
+				for _, entry := range profile.sortedGitConfig() {
+					fmt.Fprintf(w, "    %s = %s\n", entry.Key, entry.Value)
+				}
+			}
 
 			return nil
 		},
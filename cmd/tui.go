@@ -15,7 +15,8 @@ func NewTUICmd() *cobra.Command {
 		Short: "Start the terminal user interface",
 		Long:  `Launch an interactive terminal user interface to manage git profiles.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			profiles, err := LoadProfiles()
+			// Edits must not write inherited fields into the profile
+			profiles, err := LoadRawProfiles()
 			if err != nil {
 				return fmt.Errorf("failed to load profiles: %w", err)
 			}
@@ -46,9 +47,27 @@ func NewTUICmd() *cobra.Command {
 				return nil
 			}
 
+			switch selector.Action() {
+			case tui.ActionRename:
+				var repos []string
+				if repo := currentRepository(); repo != "" {
+					repos = append(repos, repo)
+				}
+				return renameProfile(cmd.OutOrStdout(), selected, selector.NewName(), repos)
+			case tui.ActionCopy:
+				if err := copyProfile(selected, selector.NewName(), ""); err != nil {
+					return err
+				}
+				fmt.Printf("Profile '%s' copied to '%s'\n", selected, selector.NewName())
+				return nil
+			}
+
 			if selector.IsEditing() {
 				// Get the profile to edit
 				profile := profiles[selected]
+				if profile.readOnly() {
+					return errReadOnlyProfile(selected, profile)
+				}
 
 				// Create and run the editor
 				editor := tui.NewProfileEditor(
@@ -56,7 +75,8 @@ func NewTUICmd() *cobra.Command {
 					profile.Email,
 					profile.GPGKey,
 					profile.SSHKey,
-					profile.SignCommits,
+					profile.signsCommits(),
+					profile.GitConfig,
 				)
 
 				p = tea.NewProgram(editor)
@@ -71,13 +91,30 @@ func NewTUICmd() *cobra.Command {
 					fields := editorModel.GetFields()
 					signCommits, _ := strconv.ParseBool(fields["Sign Commits"])
 
-					profiles[selected] = Profile{
-						Name:        fields["Name"],
-						Email:       fields["Email"],
-						GPGKey:      fields["GPG Key"],
-						SSHKey:      fields["SSH Key"],
-						SignCommits: signCommits,
+					profile.Name = fields["Name"]
+					profile.Email = fields["Email"]
+					profile.GPGKey = fields["GPG Key"]
+					profile.SSHKey = fields["SSH Key"]
+					// Keep an inherited value unless it was changed
+					if signCommits != profile.signsCommits() {
+						profile.SignCommits = boolPtr(signCommits)
+					}
+
+					gitConfig := editorModel.GetGitConfig()
+					if assignment, ok := gitConfig[tui.NewGitConfigField]; ok {
+						delete(gitConfig, tui.NewGitConfigField)
+						key, value, err := parseConfigAssignment(assignment)
+						if err != nil {
+							return err
+						}
+						gitConfig[key] = value
 					}
+					if len(gitConfig) == 0 {
+						gitConfig = nil
+					}
+					profile.GitConfig = gitConfig
+
+					profiles[selected] = profile
 
 					if err := SaveProfiles(profiles); err != nil {
 						return fmt.Errorf("failed to save profiles: %w", err)
@@ -2,17 +2,25 @@ package tui
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
+// GitConfigGroup is the editor section holding additional git config keys.
+const GitConfigGroup = "Git Config"
+
+// NewGitConfigField is the field used to add a git config entry as key=value.
+const NewGitConfigField = "Add (key=value)"
+
 type Field struct {
 	name     string
 	value    string
 	editable bool
 	cursor   int
+	group    string
 }
 
 type ProfileEditor struct {
@@ -25,7 +33,7 @@ type ProfileEditor struct {
 	saved       bool
 }
 
-func NewProfileEditor(name, email, gpgKey, sshKey string, signCommits bool) *ProfileEditor {
+func NewProfileEditor(name, email, gpgKey, sshKey string, signCommits bool, gitConfig map[string]string) *ProfileEditor {
 	fields := []Field{
 		{name: "Name", value: name, editable: true},
 		{name: "Email", value: email, editable: true},
@@ -34,6 +42,17 @@ func NewProfileEditor(name, email, gpgKey, sshKey string, signCommits bool) *Pro
 		{name: "Sign Commits", value: fmt.Sprintf("%v", signCommits), editable: true},
 	}
 
+	// Clearing the value of a git config field removes the entry
+	keys := make([]string, 0, len(gitConfig))
+	for key := range gitConfig {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fields = append(fields, Field{name: key, value: gitConfig[key], editable: true, group: GitConfigGroup})
+	}
+	fields = append(fields, Field{name: NewGitConfigField, editable: true, group: GitConfigGroup})
+
 	return &ProfileEditor{
 		fields: fields,
 	}
@@ -126,7 +145,15 @@ func (m *ProfileEditor) View() string {
 	s.WriteString(titleStyle.Render("Edit Profile"))
 	s.WriteString("\n\n")
 
+	group := ""
 	for i, field := range m.fields {
+		if field.group != group {
+			group = field.group
+			s.WriteString("\n")
+			s.WriteString(titleStyle.Render(group))
+			s.WriteString("\n")
+		}
+
 		var fieldStyle lipgloss.Style
 		if i == m.cursor {
 			if m.editing {
@@ -164,10 +191,25 @@ func (m *ProfileEditor) View() string {
 	return s.String()
 }
 
+// GetFields returns the values of the profile fields by name.
 func (m *ProfileEditor) GetFields() map[string]string {
 	result := make(map[string]string)
 	for _, field := range m.fields {
-		result[field.name] = field.value
+		if field.group == "" {
+			result[field.name] = field.value
+		}
+	}
+	return result
+}
+
+// GetGitConfig returns the git config entries that still have a value. The
+// content of the NewGitConfigField field is included under its name.
+func (m *ProfileEditor) GetGitConfig() map[string]string {
+	result := make(map[string]string)
+	for _, field := range m.fields {
+		if field.group == GitConfigGroup && field.value != "" {
+			result[field.name] = field.value
+		}
 	}
 	return result
 }
@@ -2,19 +2,34 @@ package tui
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
+// Action is what the user chose to do with the selected profile.
+type Action int
+
+const (
+	ActionUse Action = iota
+	ActionEdit
+	ActionRename
+	ActionCopy
+)
+
 type ProfileSelector struct {
 	profiles []string
 	cursor   int
 	selected string
 	err      error
 	quitting bool
-	editing  bool
+	action   Action
+
+	// prompting is set while the new name for a rename or copy is entered
+	prompting bool
+	input     string
 }
 
 func NewProfileSelector(profiles []string) *ProfileSelector {
@@ -30,6 +45,10 @@ func (m *ProfileSelector) Init() tea.Cmd {
 func (m *ProfileSelector) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.prompting {
+			return m.updatePrompt(msg)
+		}
+
 		switch msg.String() {
 		case "ctrl+c", "q":
 			m.quitting = true
@@ -47,14 +66,58 @@ func (m *ProfileSelector) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		case "e":
 			m.selected = m.profiles[m.cursor]
-			m.editing = true
+			m.action = ActionEdit
 			return m, tea.Quit
+		case "r":
+			m.action = ActionRename
+			m.prompting = true
+			m.input = m.profiles[m.cursor]
+		case "c":
+			m.action = ActionCopy
+			m.prompting = true
+			m.input = m.profiles[m.cursor] + "-copy"
 		}
 	}
 
 	return m, nil
 }
 
+// updatePrompt handles the keys while the name for a rename or copy is
+// entered.
+func (m *ProfileSelector) updatePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		m.quitting = true
+		return m, tea.Quit
+	case tea.KeyEsc:
+		m.prompting = false
+		m.action = ActionUse
+		m.err = nil
+	case tea.KeyEnter:
+		name := strings.TrimSpace(m.input)
+		switch {
+		case name == "":
+			m.err = fmt.Errorf("name is required")
+		case slices.Contains(m.profiles, name):
+			m.err = fmt.Errorf("profile '%s' already exists", name)
+		default:
+			m.selected = m.profiles[m.cursor]
+			m.input = name
+			m.prompting = false
+			return m, tea.Quit
+		}
+	case tea.KeyBackspace:
+		if len(m.input) > 0 {
+			runes := []rune(m.input)
+			m.input = string(runes[:len(runes)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.input += string(msg.Runes)
+	}
+
+	return m, nil
+}
+
 func (m *ProfileSelector) View() string {
 	if m.quitting {
 		return ""
@@ -75,7 +138,16 @@ func (m *ProfileSelector) View() string {
 	}
 
 	s.WriteString("\n")
-	s.WriteString(lipgloss.NewStyle().Foreground(subtle).Render("↑/↓: Navigate • enter: Select • e: Edit • q: Quit"))
+	if m.prompting {
+		verb := "Rename"
+		if m.action == ActionCopy {
+			verb = "Copy"
+		}
+		s.WriteString(fmt.Sprintf("%s '%s' to: %s█\n\n", verb, m.profiles[m.cursor], m.input))
+		s.WriteString(lipgloss.NewStyle().Foreground(subtle).Render("enter: Confirm • esc: Cancel"))
+	} else {
+		s.WriteString(lipgloss.NewStyle().Foreground(subtle).Render("↑/↓: Navigate • enter: Select • e: Edit • r: Rename • c: Copy • q: Quit"))
+	}
 
 	if m.err != nil {
 		s.WriteString("\n\n")
@@ -90,5 +162,15 @@ func (m *ProfileSelector) Selected() string {
 }
 
 func (m *ProfileSelector) IsEditing() bool {
-	return m.editing
+	return m.action == ActionEdit
+}
+
+// Action returns what to do with the selected profile.
+func (m *ProfileSelector) Action() Action {
+	return m.action
+}
+
+// NewName returns the name entered for a rename or copy.
+func (m *ProfileSelector) NewName() string {
+	return m.input
 }
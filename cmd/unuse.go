@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func NewUnuseCmd() *cobra.Command {
+	var restore, global, worktree bool
+
+	cmd := &cobra.Command{
+		Use:   "unuse",
+		Short: "Deactivate the git profile in the current repository",
+		Long: `Remove the git configuration that 'use' wrote to the current repository.
+Only keys set by gitprofile are removed. With --restore the values those keys
+had before the first 'use' are put back. Remote URLs rewritten by
+'use --ssh-alias' are always put back. --global and --worktree select the
+config a profile was activated in with 'use --global' or 'use --worktree'.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			scope, err := scopeFromFlags(global, worktree)
+			if err != nil {
+				return err
+			}
+			if err := checkScope(scope); err != nil {
+				return err
+			}
+
+			state, err := loadRepoState("", scope)
+			if err != nil {
+				return fmt.Errorf("failed to read gitprofile state: %w", err)
+			}
+
+			if len(state.Managed) == 0 {
+				return fmt.Errorf("no profile was activated in the %s by gitprofile", scopeDescription(scope))
+			}
+
+			restores, err := planRemoteRestores(state, "")
+			if err != nil {
+				return err
+			}
+			if err := restoreRemoteURLs(state, restores, ""); err != nil {
+				return err
+			}
+
+			profileName := state.Profile
+			for _, key := range state.Managed {
+				if _, err := runGitCommand("config", scope, "--unset-all", key); err != nil && gitExitCode(err) != 5 {
+					return fmt.Errorf("failed to unset %s: %w", key, err)
+				}
+
+				if !restore {
+					continue
+				}
+				if value, ok := state.PreviousValue(key); ok {
+					if _, err := runGitCommand("config", scope, key, value); err != nil {
+						return fmt.Errorf("failed to restore %s: %w", key, err)
+					}
+				}
+			}
+
+			if err := state.clear(); err != nil {
+				return fmt.Errorf("failed to clear repository state: %w", err)
+			}
+
+			for _, change := range restores {
+				fmt.Fprintf(cmd.OutOrStdout(), "Restored %s = %s\n", change.Key, change.New)
+			}
+			if restore {
+				fmt.Fprintf(cmd.OutOrStdout(), "Deactivated profile '%s' and restored previous configuration in %s\n", profileName, scopeDescription(scope))
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "Deactivated profile '%s' in %s\n", profileName, scopeDescription(scope))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&restore, "restore", false, "Restore the values that were set before the profile was used")
+	cmd.Flags().BoolVar(&global, "global", false, "Deactivate the profile in the global git config")
+	cmd.Flags().BoolVar(&worktree, "worktree", false, "Deactivate the profile for the current worktree only")
+
+	return cmd
+}
@@ -1,79 +1,192 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
+// useResult is the machine readable outcome of use with --output json.
+type useResult struct {
+	Profile string         `json:"profile"`
+	Scope   string         `json:"scope"`
+	DryRun  bool           `json:"dry_run"`
+	Match   *RemoteMatch   `json:"match,omitempty"`
+	Changes []configChange `json:"changes"`
+	Remote  *configChange  `json:"remote,omitempty"`
+
+	// Restored are remote URLs put back after an earlier use --ssh-alias
+	Restored []configChange `json:"restored,omitempty"`
+}
+
 func NewUseCmd() *cobra.Command {
+	var auto, dryRun, global, worktree, force, sshAlias bool
+	var remoteName, output string
+
 	cmd := &cobra.Command{
 		Use:   "use [profile-name]",
 		Short: "Use a git profile in the current repository",
 		Long: `Set the git configuration for the current repository using a saved profile.
-This will set user.name, user.email, GPG signing, and SSH key configuration.`,
-		Args: cobra.ExactArgs(1),
+This will set user.name, user.email, GPG signing, and SSH key configuration.
+With --global the profile becomes the machine-wide default instead, with
+--worktree it only applies to the current worktree.
+With --auto the profile is picked by matching the remote URL against the
+remote rules of all profiles. Keys the previous profile set but this one
+does not get back the value they had before gitprofile, or are unset.
+With --dry-run the keys that would be set, changed, restored or unset are
+printed without modifying the repository.
+With --ssh-alias the remote URL is rewritten to the profile's host alias
+written by 'gitprofile ssh-config sync', e.g. git@github.com-work:acme/app.
+The original URL is kept and put back by 'unuse' or by using a profile
+without --ssh-alias.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Check if we're in a git repository
-			_, err := runGitCommand("rev-parse", "--git-dir")
+			if auto && len(args) > 0 {
+				return fmt.Errorf("cannot combine a profile name with --auto")
+			}
+			if !auto && len(args) == 0 {
+				return fmt.Errorf("requires a profile name or --auto")
+			}
+			if output != "text" && output != "json" {
+				return fmt.Errorf("invalid output format '%s' (must be text or json)", output)
+			}
+			scope, err := scopeFromFlags(global, worktree)
 			if err != nil {
-				return fmt.Errorf("not a git repository (or any of the parent directories)")
+				return err
+			}
+			if sshAlias && scope == scopeGlobal {
+				return fmt.Errorf("cannot combine --ssh-alias and --global")
+			}
+			if err := checkScope(scope); err != nil {
+				return err
 			}
 
-			profileName := args[0]
 			profiles, err := LoadProfiles()
 			if err != nil {
 				return fmt.Errorf("failed to load profiles: %w", err)
 			}
 
+			var profileName string
+			var match *RemoteMatch
+			if auto {
+				match, err = findRepoRemoteMatch(profiles, remoteName)
+				if err != nil {
+					return err
+				}
+				profileName = match.ProfileName
+			} else {
+				profileName = args[0]
+			}
+
 			profile, exists := profiles[profileName]
 			if !exists {
 				return fmt.Errorf("profile '%s' not found", profileName)
 			}
 
-			// Set user.name
-			_, err = runGitCommand("config", "--local", "user.name", profile.Name)
+			plan, state, err := prepareActivation("", profileName, profile, scope)
 			if err != nil {
-				return fmt.Errorf("failed to set user.name: %w", err)
+				return err
 			}
 
-			// Set user.email
-			_, err = runGitCommand("config", "--local", "user.email", profile.Email)
-			if err != nil {
-				return fmt.Errorf("failed to set user.email: %w", err)
+			if scope == scopeGlobal && !force {
+				if err := checkGlobalOverride(profile, state); err != nil {
+					return err
+				}
 			}
 
-			// Handle GPG settings if configured
-			if profile.GPGKey != "" {
-				_, err = runGitCommand("config", "--local", "user.signingkey", profile.GPGKey)
+			// Remotes aliased for the previous profile get their URL back,
+			// unless they are aliased again
+			keepRemote := ""
+			var remoteChange *configChange
+			if sshAlias {
+				keepRemote = remoteName
+				remoteChange, err = planRemoteAlias(state, remoteName, profileName, profiles)
 				if err != nil {
-					return fmt.Errorf("failed to set signing key: %w", err)
+					return err
 				}
 			}
-
-			// Set commit signing
-			signValue := "false"
-			if profile.SignCommits {
-				signValue = "true"
-			}
-			_, err = runGitCommand("config", "--local", "commit.gpgsign", signValue)
+			restores, err := planRemoteRestores(state, keepRemote)
 			if err != nil {
-				return fmt.Errorf("failed to set commit signing: %w", err)
+				return err
 			}
 
-			// Configure SSH key if specified
-			if profile.SSHKey != "" {
-				_, err = runGitCommand("config", "--local", "core.sshCommand", fmt.Sprintf("ssh -i %s", profile.SSHKey))
-				if err != nil {
-					return fmt.Errorf("failed to set SSH key: %w", err)
+			if !dryRun {
+				if err := plan.apply(state); err != nil {
+					return err
+				}
+				if err := restoreRemoteURLs(state, restores, keepRemote); err != nil {
+					return err
+				}
+				if remoteChange != nil {
+					if err := applyRemoteAlias(state, remoteName, remoteChange); err != nil {
+						return err
+					}
 				}
 			}
 
-			fmt.Printf("Successfully activated profile '%s' in current repository\n", profileName)
+			w := cmd.OutOrStdout()
+
+			if output == "json" {
+				result := useResult{
+					Profile:  profileName,
+					Scope:    strings.TrimPrefix(scope, "--"),
+					DryRun:   dryRun,
+					Match:    match,
+					Changes:  plan.Changes,
+					Remote:   remoteChange,
+					Restored: restores,
+				}
+				if result.Changes == nil {
+					result.Changes = []configChange{}
+				}
+
+				encoder := json.NewEncoder(w)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(result)
+			}
+
+			if match != nil {
+				fmt.Fprintf(w, "Remote %s matches rule '%s' of profile '%s'\n", match.URL, match.Rule, profileName)
+			}
+
+			// Remote URLs are not managed keys of the profile, only reported
+			plan.Changes = append(plan.Changes, restores...)
+			if remoteChange != nil {
+				plan.Changes = append(plan.Changes, *remoteChange)
+			}
+
+			switch {
+			case dryRun && len(plan.Changes) == 0:
+				fmt.Fprintf(w, "Profile '%s' is already active, nothing would change\n", profileName)
+			case dryRun:
+				fmt.Fprintf(w, "Activating profile '%s' would make these changes:\n", profileName)
+				plan.printSummary(w)
+			default:
+				fmt.Fprintf(w, "Successfully activated profile '%s' in %s\n", profileName, scopeDescription(scope))
+				plan.printSummary(w)
+			}
+
+			if remoteChange != nil {
+				printSSHAliasHint(w, remoteChange.New)
+			}
 			return nil
 		},
 		ValidArgsFunction: ValidProfileArgsForUse,
 	}
 
+	cmd.Flags().BoolVar(&auto, "auto", false, "Pick the profile whose remote rules match the repository")
+	cmd.Flags().StringVar(&remoteName, "remote", "origin", "Remote whose URL is matched with --auto or rewritten with --ssh-alias")
+	cmd.Flags().BoolVar(&global, "global", false, "Activate the profile in the global git config")
+	cmd.Flags().BoolVar(&worktree, "worktree", false, "Activate the profile for the current worktree only")
+	cmd.Flags().BoolVar(&force, "force", false, "Override an existing global identity with --global")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes without applying them")
+	cmd.Flags().BoolVar(&sshAlias, "ssh-alias", false, "Rewrite the remote URL to the profile's SSH host alias")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text or json)")
+	cmd.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"text", "json"}, cobra.ShellCompDirectiveNoFileComp
+	})
+
 	return cmd
 }
@@ -16,14 +16,35 @@ func main() {
 It allows you to save and switch between different git profiles with different names, emails, and GPG keys.`,
 	}
 
+	cmd.AddConfigFlag(rootCmd)
+
 	rootCmd.AddCommand(
 		cmd.NewAddCmd(),
 		cmd.NewListCmd(),
+		cmd.NewShowCmd(),
 		cmd.NewUseCmd(),
+		cmd.NewUnuseCmd(),
 		cmd.NewStatusCmd(),
 		cmd.NewDeleteCmd(),
 		cmd.NewCompletionCmd(),
 		cmd.NewTUICmd(),
+		cmd.NewBindCmd(),
+		cmd.NewUnbindCmd(),
+		cmd.NewBindingsCmd(),
+		cmd.NewAutoCmd(),
+		cmd.NewDoctorCmd(),
+		cmd.NewHookCmd(),
+		cmd.NewAuditCmd(),
+		cmd.NewFixCommitsCmd(),
+		cmd.NewApplyCmd(),
+		cmd.NewScanCmd(),
+		cmd.NewCloneCmd(),
+		cmd.NewSSHConfigCmd(),
+		cmd.NewConfigCmd(),
+		cmd.NewExportCmd(),
+		cmd.NewImportCmd(),
+		cmd.NewRenameCmd(),
+		cmd.NewCopyCmd(),
 	)
 
 	if err := rootCmd.Execute(); err != nil {